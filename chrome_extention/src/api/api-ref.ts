@@ -3,6 +3,7 @@
  * 展示如何使用 OpenAPI Generator 生成的 API 代码
  */
 
+import axios, { type AxiosError, type InternalAxiosRequestConfig } from 'axios';
 import { Configuration, HostApi, OptApi, ToolApi } from './index';
 import type { HostPostRequest, OptRequest } from './models';
 
@@ -13,19 +14,56 @@ import type { HostPostRequest, OptRequest } from './models';
 // 创建配置对象 - 基础配置
 const config = new Configuration({
   basePath: 'http://localhost:15920', // 你的 API 基础路径
-  // 如果需要认证,可以添加以下配置:
-  // apiKey: 'your-api-key',
-  // accessToken: 'your-access-token',
-  // 或者使用函数动态获取 token:
-  // accessToken: async () => {
-  //   return await getTokenFromStorage();
-  // }
+  // 认证 token 由下方的 http 实例从 chrome.storage 读取并添加到请求头
+});
+
+// ============================================
+// 认证: host_manager 的修改类接口需要 API token
+// ============================================
+
+// token 保存在 chrome.storage.local, 对应 host_manager 的 auth.token 或自动生成的 data/auth_token
+const TOKEN_KEY = 'hostboostToken';
+
+async function getToken(): Promise<string> {
+  const stored = await chrome.storage.local.get(TOKEN_KEY);
+  return (stored[TOKEN_KEY] as string | undefined) ?? '';
+}
+
+async function setToken(token: string): Promise<void> {
+  await chrome.storage.local.set({ [TOKEN_KEY]: token });
+}
+
+const http = axios.create();
+
+// 每个请求都带上 token, 只读接口会忽略它
+http.interceptors.request.use(async (req: InternalAxiosRequestConfig) => {
+  const token = await getToken();
+  if (token) {
+    req.headers.set('Authorization', `Bearer ${token}`);
+  }
+  return req;
+});
+
+// 401 时提示输入 token, 保存后重试一次
+http.interceptors.response.use(undefined, async (error: AxiosError) => {
+  const req = error.config as (InternalAxiosRequestConfig & { _retried?: boolean }) | undefined;
+  if (error.response?.status !== 401 || !req || req._retried) {
+    throw error;
+  }
+
+  const token = window.prompt('请输入 HostBoost API token（host_manager 的 data/auth_token）');
+  if (!token) {
+    throw error;
+  }
+  await setToken(token.trim());
+  req._retried = true;
+  return http.request(req);
 });
 
 // 创建 API 实例
-const hostApi = new HostApi(config);
-const optApi = new OptApi(config);
-const toolApi = new ToolApi(config);
+const hostApi = new HostApi(config, undefined, http);
+const optApi = new OptApi(config, undefined, http);
+const toolApi = new ToolApi(config, undefined, http);
 
 // ============================================
 // 2. HostApi 使用示例
@@ -124,7 +162,7 @@ export async function getOptExample() {
     
     // response.data 就是 OptVo 对象
     const optData = response.data;
-    console.log(`优选IP: ${optData.ip}, 延迟: ${optData.delay}ms, 速率: ${optData.rate}`);
+    console.log(`优选IP: ${optData.ip}, 延迟: ${optData.delay}ms, 速度: ${optData.speed}MB/s, 丢包率: ${optData.loss_rate}`);
     return optData;
   } catch (error) {
     console.error('获取优选IP失败:', error);
@@ -237,7 +275,7 @@ export async function batchAddHosts(domains: string[]) {
 // 5. 导出配置好的 API 实例供全局使用
 // ============================================
 
-export { hostApi, optApi, config,toolApi };
+export { hostApi, optApi, config, toolApi, setToken };
 
 // 如果需要重新配置 API (例如切换环境)
 export function reconfigureApi(newBasePath: string) {
@@ -247,7 +285,7 @@ export function reconfigureApi(newBasePath: string) {
   });
   
   return {
-    hostApi: new HostApi(newConfig),
-    optApi: new OptApi(newConfig)
+    hostApi: new HostApi(newConfig, undefined, http),
+    optApi: new OptApi(newConfig, undefined, http)
   };
 }
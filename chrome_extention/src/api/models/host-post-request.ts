@@ -26,5 +26,11 @@ export interface HostPostRequest {
      * @memberof HostPostRequest
      */
     'domain': string;
+    /**
+     * CDN 类型，留空时由服务端自动识别
+     * @type {string}
+     * @memberof HostPostRequest
+     */
+    'type'?: string;
 }
 
@@ -27,16 +27,45 @@ export interface OptVo {
      */
     'ip': string;
     /**
-     * 
+     * 平均延迟(ms)
+     * @type {number}
+     * @memberof OptVo
+     */
+    'delay': number;
+    /**
+     * 下载速度(MB/s)
+     * @type {number}
+     * @memberof OptVo
+     */
+    'speed': number;
+    /**
+     * 丢包率(0~1)
+     * @type {number}
+     * @memberof OptVo
+     */
+    'loss_rate': number;
+    /**
+     * 测速节点所在地区码
      * @type {string}
      * @memberof OptVo
      */
-    'delay': string;
+    'colo'?: string;
     /**
-     * 
+     * 延迟测试发送次数
+     * @type {number}
+     * @memberof OptVo
+     */
+    'sent'?: number;
+    /**
+     * 延迟测试成功次数
+     * @type {number}
+     * @memberof OptVo
+     */
+    'received'?: number;
+    /**
+     * 测速时间(RFC3339)
      * @type {string}
      * @memberof OptVo
      */
-    'rate': string;
+    'tested_at'?: string;
 }
-
@@ -50,6 +50,9 @@ type Config struct {
 	ReportServerURL string `yaml:"report_server_url"` // 上报服务器地址
 	ReportType      string `yaml:"report_type"`       // 上报类型
 	ReportTimeout   int    `yaml:"report_timeout"`    // 上报超时时间(秒)
+	ReportMode      string `yaml:"report_mode"`       // 上报模式: replace 或 merge, 为空时使用服务端默认
+	ReportToken     string `yaml:"report_token"`      // host_manager 的 API token
+	ReportSecret    string `yaml:"report_secret"`     // host_manager 的 HMAC 密钥, 配置后优先于 token
 }
 
 // DefaultConfig 返回默认配置
@@ -193,6 +196,15 @@ report_type: "` + config.ReportType + `"
 
 # 上报超时时间，单位秒 (默认 10)
 report_timeout: ` + fmt.Sprintf("%d", config.ReportTimeout) + `
+
+# 上报模式: replace 覆盖服务端的优选池, merge 与其他设备上报的结果合并 (默认为空, 使用服务端配置)
+report_mode: "` + config.ReportMode + `"
+
+# host_manager 的 API token (host_manager 配置中的 auth.token, 未配置时见其 data/auth_token 文件)
+report_token: "` + config.ReportToken + `"
+
+# host_manager 的 HMAC 密钥 (auth.hmac_secret), 配置后使用签名认证, 优先于 report_token
+report_secret: "` + config.ReportSecret + `"
 `
 
 	return os.WriteFile(filename, []byte(content), 0644)
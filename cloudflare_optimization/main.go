@@ -297,9 +297,19 @@ func run() {
 	if globalConfig != nil && globalConfig.EnableReport && len(speedData) > 0 {
 		fmt.Println("\n正在上报结果到服务器...")
 		reportConfig := &task.ReportConfig{
-			ServerURL: globalConfig.ReportServerURL,
-			Type:      globalConfig.ReportType,
-			Timeout:   globalConfig.ReportTimeout,
+			ServerURL:  globalConfig.ReportServerURL,
+			Type:       globalConfig.ReportType,
+			Timeout:    globalConfig.ReportTimeout,
+			Mode:       globalConfig.ReportMode,
+			Token:      globalConfig.ReportToken,
+			HMACSecret: globalConfig.ReportSecret,
+		}
+		// 由 host_manager 的 opt.reoptimize.command 启动时, 未配置的认证信息从环境变量读取
+		if reportConfig.Token == "" {
+			reportConfig.Token = os.Getenv("HOSTBOOST_TOKEN")
+		}
+		if reportConfig.HMACSecret == "" {
+			reportConfig.HMACSecret = os.Getenv("HOSTBOOST_HMAC_SECRET")
 		}
 		if err := task.Report(speedData, reportConfig); err != nil {
 			fmt.Printf("上报失败: %v\n", err)
@@ -2,10 +2,15 @@ package task
 
 import (
 	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
+	"os"
 	"strconv"
 	"time"
 
@@ -14,15 +19,22 @@ import (
 
 // OptVo 优选IP数据结构
 type OptVo struct {
-	IP    string `json:"ip"`
-	Delay string `json:"delay"`
-	Rate  string `json:"rate"`
+	IP       string    `json:"ip"`
+	Delay    float64   `json:"delay"`     // 平均延迟(ms)
+	Speed    float64   `json:"speed"`     // 下载速度(MB/s)
+	LossRate float64   `json:"loss_rate"` // 丢包率(0~1)
+	Colo     string    `json:"colo,omitempty"`
+	Sent     int       `json:"sent"`     // 延迟测试发送次数
+	Received int       `json:"received"` // 延迟测试成功次数
+	TestedAt time.Time `json:"tested_at"`
 }
 
 // OptRequest 上报请求结构
 type OptRequest struct {
-	Type string  `json:"type"`
-	Data []OptVo `json:"data"`
+	Type     string  `json:"type"`
+	Data     []OptVo `json:"data"`
+	Reporter string  `json:"reporter,omitempty"` // 上报方标识, 用于服务端的上报历史
+	Mode     string  `json:"mode,omitempty"`     // 上报模式: replace 或 merge
 }
 
 // BaseResponse 响应结构
@@ -33,9 +45,13 @@ type BaseResponse struct {
 
 // ReportConfig 上报配置
 type ReportConfig struct {
-	ServerURL string // 服务器地址，默认 http://127.0.0.1:15920
-	Type      string // 类型，如 "cloudflare"
-	Timeout   int    // 超时时间（秒），默认 10
+	ServerURL  string // 服务器地址，默认 http://127.0.0.1:15920
+	Type       string // 类型，如 "cloudflare"
+	Timeout    int    // 超时时间（秒），默认 10
+	Reporter   string // 上报方标识，为空时使用本机主机名
+	Mode       string // 上报模式：replace 覆盖，merge 与服务端已有优选合并，为空时使用服务端默认
+	Token      string // 服务端 auth.token（或自动生成的 data/auth_token），以 Bearer 方式发送
+	HMACSecret string // 服务端 auth.hmac_secret，配置后对请求签名，优先于 Token
 }
 
 var DefaultReportConfig = ReportConfig{
@@ -65,25 +81,34 @@ func Report(speedData []utils.CloudflareIPData, config *ReportConfig) error {
 	}
 
 	// 转换数据格式
+	testedAt := time.Now()
 	optData := make([]OptVo, 0, reportCount)
 	for i := 0; i < reportCount; i++ {
 		data := speedData[i]
-		// 计算延迟（毫秒）
-		delayMs := data.Delay.Seconds() * 1000
-		// 计算下载速度（MB/s）
-		speedMBps := data.DownloadSpeed / 1024 / 1024
 
 		optData = append(optData, OptVo{
-			IP:    data.IP.String(),
-			Delay: strconv.FormatFloat(delayMs, 'f', 0, 64),
-			Rate:  strconv.FormatFloat(speedMBps, 'f', 2, 64),
+			IP:       data.IP.String(),
+			Delay:    round(data.Delay.Seconds()*1000, 2),    // 毫秒
+			Speed:    round(data.DownloadSpeed/1024/1024, 2), // MB/s
+			LossRate: round(float64(data.LossRate()), 4),
+			Colo:     data.Colo,
+			Sent:     data.Sended,
+			Received: data.Received,
+			TestedAt: testedAt,
 		})
 	}
 
+	reporter := config.Reporter
+	if reporter == "" {
+		reporter, _ = os.Hostname()
+	}
+
 	// 构建请求
 	request := OptRequest{
-		Type: config.Type,
-		Data: optData,
+		Type:     config.Type,
+		Data:     optData,
+		Reporter: reporter,
+		Mode:     config.Mode,
 	}
 
 	// 序列化为 JSON
@@ -99,7 +124,14 @@ func Report(speedData []utils.CloudflareIPData, config *ReportConfig) error {
 
 	// 发送 POST 请求
 	url := config.ServerURL + "/opt/report"
-	resp, err := client.Post(url, "application/json", bytes.NewBuffer(jsonData))
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(jsonData))
+	if err != nil {
+		return fmt.Errorf("创建请求失败: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	setAuthHeaders(req, jsonData, config)
+
+	resp, err := client.Do(req)
 	if err != nil {
 		return fmt.Errorf("发送请求失败: %v", err)
 	}
@@ -118,6 +150,9 @@ func Report(speedData []utils.CloudflareIPData, config *ReportConfig) error {
 	}
 
 	// 检查响应状态
+	if resp.StatusCode == http.StatusUnauthorized {
+		return fmt.Errorf("服务器拒绝上报（认证失败）: %s，请检查 report_token / report_secret 配置", response.Message)
+	}
 	if resp.StatusCode != http.StatusOK {
 		return fmt.Errorf("服务器返回错误状态: %d, 消息: %s", resp.StatusCode, response.Message)
 	}
@@ -135,3 +170,27 @@ func Report(speedData []utils.CloudflareIPData, config *ReportConfig) error {
 	fmt.Printf("上报成功: 已上报 %d 个最优 IP, code=%s, message=%s\n", reportCount, codeStr, response.Message)
 	return nil
 }
+
+// setAuthHeaders 为请求添加认证信息:
+// 配置了 HMACSecret 时以 HMAC-SHA256 签名 "<时间戳>\n<方法>\n<请求路径>\n<请求体>"，否则发送 Bearer Token
+func setAuthHeaders(req *http.Request, body []byte, config *ReportConfig) {
+	if config.HMACSecret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		mac := hmac.New(sha256.New, []byte(config.HMACSecret))
+		mac.Write([]byte(timestamp + "\n" + req.Method + "\n" + req.URL.RequestURI() + "\n"))
+		mac.Write(body)
+		req.Header.Set("X-HostBoost-Timestamp", timestamp)
+		req.Header.Set("X-HostBoost-Signature", hex.EncodeToString(mac.Sum(nil)))
+		return
+	}
+
+	if config.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+config.Token)
+	}
+}
+
+// round 保留 n 位小数
+func round(v float64, n int) float64 {
+	p := math.Pow(10, float64(n))
+	return math.Round(v*p) / p
+}
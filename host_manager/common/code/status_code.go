@@ -2,7 +2,8 @@ package code
 
 // 业务状态码
 const (
-	Success  = 200
-	NotFound = 404
-	Error    = 500
+	Success      = 200
+	Unauthorized = 401
+	NotFound     = 404
+	Error        = 500
 )
@@ -10,9 +10,70 @@ import (
 
 // Config 包含应用程序的所有配置
 type Config struct {
-	Server ServerConfig `yaml:"server"`
-	Data   DataConfig   `yaml:"data"`
-	CORS   CORSConfig   `yaml:"cors"`
+	Server   ServerConfig   `yaml:"server"`
+	Data     DataConfig     `yaml:"data"`
+	CORS     CORSConfig     `yaml:"cors"`
+	CDN      CDNConfig      `yaml:"cdn"`
+	Failover FailoverConfig `yaml:"failover"`
+	Health   HealthConfig   `yaml:"health"`
+	Expiry   ExpiryConfig   `yaml:"expiry"`
+	Revision RevisionConfig `yaml:"revision"`
+	History  HistoryConfig  `yaml:"history"`
+	Opt      OptConfig      `yaml:"opt"`
+	Auth     AuthConfig     `yaml:"auth"`
+	Sync     SyncConfig     `yaml:"sync"`
+	DNS      DNSConfig      `yaml:"dns"`
+}
+
+// DNSConfig 内置 DNS 服务配置: 托管域名的 A/AAAA 查询直接返回当前 IP, 其余查询转发到上游
+type DNSConfig struct {
+	Enabled   bool     `yaml:"enabled"`
+	Listen    string   `yaml:"listen"`    // 同时监听 UDP 与 TCP 的地址
+	Upstreams []string `yaml:"upstreams"` // 上游 DNS, 按顺序尝试: "host:port"(未写端口时使用 53) 或 DoH 地址 "https://..."
+	Timeout   string   `yaml:"timeout"`   // 单个上游的查询超时
+	TTL       uint32   `yaml:"ttl"`       // 托管域名应答的 TTL(秒), 较小的值让客户端尽快感知优选 IP 的更换
+	// DoH 在 HTTP 端口上提供 RFC 8484 的 /dns-query 接口, 与 enabled 互不影响
+	DoH bool `yaml:"doh"`
+}
+
+// SyncConfig 系统 hosts 文件之外的同步目标, 每次同步时与系统 hosts 写入相同的条目
+type SyncConfig struct {
+	SystemHosts bool              `yaml:"system_hosts"` // 是否写入系统 hosts 文件; 为 false 时只写入同步目标
+	Reconcile   ReconcileConfig   `yaml:"reconcile"`
+	Targets     SyncTargetsConfig `yaml:"targets"`
+}
+
+// ReconcileConfig 定期检查系统 hosts 文件的管理区域是否被其他工具改写
+type ReconcileConfig struct {
+	Enabled  bool   `yaml:"enabled"`
+	Interval string `yaml:"interval"` // 检查周期
+	Repair   bool   `yaml:"repair"`   // 发现改写时重新写入管理区域; 为 false 时只记录
+}
+
+// SyncTargetsConfig 各局域网 DNS 服务的同步目标
+type SyncTargetsConfig struct {
+	Dnsmasq SyncTargetConfig `yaml:"dnsmasq"` // host-record=域名,IP 配置文件
+	Unbound SyncTargetConfig `yaml:"unbound"` // local-data 记录, 通过 include: 引入
+	CoreDNS SyncTargetConfig `yaml:"coredns"` // hosts 插件读取的 hosts 文件
+	AdGuard SyncTargetConfig `yaml:"adguard"` // $dnsrewrite 规则列表, 在 AdGuard Home 中添加为本地过滤列表
+}
+
+// SyncTargetConfig 单个同步目标
+type SyncTargetConfig struct {
+	Enabled bool     `yaml:"enabled"`
+	Path    string   `yaml:"path"`   // 写入的文件
+	Reload  []string `yaml:"reload"` // 可选, 文件内容变化后执行的命令及参数, 如 ["systemctl", "restart", "dnsmasq"]
+}
+
+// AuthConfig 修改类接口的认证配置, 只读接口无需认证
+type AuthConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Token 通过 "Authorization: Bearer <token>" 或 X-HostBoost-Token 请求头发送
+	Token string `yaml:"token"`
+	// HMACSecret 用于校验 X-HostBoost-Signature 请求签名
+	HMACSecret string `yaml:"hmac_secret"`
+	// TokenFile token 与 hmac_secret 都未配置时, 自动生成的 token 保存在该文件中
+	TokenFile string `yaml:"token_file"`
 }
 
 // ServerConfig 服务器相关配置
@@ -22,8 +83,100 @@ type ServerConfig struct {
 
 // DataConfig 数据存储相关配置
 type DataConfig struct {
-	HostFile string `yaml:"host_file"`
-	OptFile  string `yaml:"opt_file"`
+	// Driver 存储后端: json (默认, 使用 host_file/opt_file) 或 sqlite
+	Driver      string `yaml:"driver"`
+	HostFile    string `yaml:"host_file"`
+	OptFile     string `yaml:"opt_file"`
+	SQLiteFile  string `yaml:"sqlite_file"`  // driver 为 sqlite 时使用的数据库文件
+	AuditFile   string `yaml:"audit_file"`   // driver 为 json 时审计日志的 JSON Lines 文件
+	RevisionDir string `yaml:"revision_dir"` // driver 为 json 时版本快照的保存目录
+	HistoryFile string `yaml:"history_file"` // driver 为 json 时优选上报历史的 JSON Lines 文件
+}
+
+// HistoryConfig 优选上报历史相关配置
+type HistoryConfig struct {
+	Retention string `yaml:"retention"` // 保留时长, 如 "720h"; "0" 表示永久保留
+}
+
+// OptConfig 优选数据相关配置
+type OptConfig struct {
+	// QuarantineCooldown 被更换掉的 IP 的隔离时长, 期间上报的同一 IP 会被过滤; "0" 表示不隔离
+	QuarantineCooldown string `yaml:"quarantine_cooldown"`
+	// MaxAge 超过该时长未上报的优选数据视为过期; "0" 表示不检查
+	MaxAge string `yaml:"max_age"`
+	// MinPool 优选池少于该数量的 IP 时视为存量不足
+	MinPool       int    `yaml:"min_pool"`
+	CheckInterval string `yaml:"check_interval"` // 过期与存量检查周期
+	// Reoptimize 数据过期或存量不足时请求重新优选, url 与 command 都为空时只在 API 中标记
+	Reoptimize ReoptimizeConfig `yaml:"reoptimize"`
+	// ReportMode 上报请求未指定 mode 时的模式: replace(默认) 或 merge
+	ReportMode string      `yaml:"report_mode"`
+	Merge      MergeConfig `yaml:"merge"`
+}
+
+// MergeConfig 合并模式的评分与淘汰配置
+type MergeConfig struct {
+	EntryMaxAge string       `yaml:"entry_max_age"` // 测速时间超过该时长的 IP 被淘汰; "0" 表示不淘汰
+	MaxPool     int          `yaml:"max_pool"`      // 合并后保留的最多 IP 数量, 0 表示不限制
+	Weights     ScoreWeights `yaml:"weights"`
+}
+
+// ScoreWeights 评分权重: 速度(MB/s) 加分, 延迟(ms)、丢包率(%)、测速距今(小时) 减分
+type ScoreWeights struct {
+	Delay float64 `yaml:"delay"`
+	Speed float64 `yaml:"speed"`
+	Loss  float64 `yaml:"loss"`
+	Age   float64 `yaml:"age"`
+}
+
+// ReoptimizeConfig 重新优选触发方式
+type ReoptimizeConfig struct {
+	URL      string   `yaml:"url"`      // POST {"type": "...", "reason": "..."} 到该地址
+	Command  []string `yaml:"command"`  // 执行的命令及参数, 如 ["./cf_opt", "-c", "config.yaml"]
+	Cooldown string   `yaml:"cooldown"` // 同一类型两次自动触发的最小间隔
+	Timeout  string   `yaml:"timeout"`  // 命令的最长运行时间, 超时后终止, 避免卡住的命令阻止后续触发
+}
+
+// RevisionConfig 版本快照相关配置
+type RevisionConfig struct {
+	Keep int `yaml:"keep"` // 保留的最近版本数量
+}
+
+// 支持的存储后端
+const (
+	DriverJSON   = "json"
+	DriverSQLite = "sqlite"
+)
+
+// CDNConfig CDN 类型识别相关配置
+type CDNConfig struct {
+	// DefaultType 无法根据解析结果识别 CDN 时使用的类型
+	DefaultType string `yaml:"default_type"`
+	// Ranges 各 CDN 类型对应的 CIDR 列表，key 为 type
+	Ranges map[string][]string `yaml:"ranges"`
+}
+
+// FailoverConfig 多 IP 故障转移相关配置
+type FailoverConfig struct {
+	Enabled   bool   `yaml:"enabled"`
+	Fallbacks int    `yaml:"fallbacks"` // 每个 host 除主 IP 外保留的备用 IP 数量
+	Interval  string `yaml:"interval"`  // 检测周期
+	Timeout   string `yaml:"timeout"`   // 单次 TLS 握手超时
+}
+
+// HealthConfig 当前优选 IP 的健康检测配置
+type HealthConfig struct {
+	Enabled    bool   `yaml:"enabled"`
+	Interval   string `yaml:"interval"`    // 检测周期
+	Timeout    string `yaml:"timeout"`     // TCP 连接、TLS 握手与 HTTP 请求各自的超时
+	MaxLatency string `yaml:"max_latency"` // 任一步骤耗时超过该值视为失败; "0" 表示不检查延迟
+	Failures   int    `yaml:"failures"`    // 连续失败多少次后自动更换优选 IP
+	HTTPPath   string `yaml:"http_path"`   // 可选, 握手后请求的路径, 如 "/cdn-cgi/trace"; 为空时不发送 HTTP 请求
+}
+
+// ExpiryConfig 限时 host 清理相关配置
+type ExpiryConfig struct {
+	CheckInterval string `yaml:"check_interval"` // 过期检查周期
 }
 
 // CORSConfig CORS 相关配置
@@ -43,17 +196,123 @@ func DefaultConfig() *Config {
 			Port: "127.0.0.1:15920",
 		},
 		Data: DataConfig{
-			HostFile: "data/hosts.json",
-			OptFile:  "data/opts.json",
+			Driver:      DriverJSON,
+			HostFile:    "data/hosts.json",
+			OptFile:     "data/opts.json",
+			SQLiteFile:  "data/hostboost.db",
+			AuditFile:   "data/audit.jsonl",
+			RevisionDir: "data/revisions",
+			HistoryFile: "data/opt_history.jsonl",
 		},
 		CORS: CORSConfig{
 			AllowOrigins:     []string{"*"},
-			AllowMethods:     []string{"GET", "POST", "DELETE", "OPTIONS"},
-			AllowHeaders:     []string{"Content-Type", "Authorization", "X-Requested-With"},
+			AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+			AllowHeaders:     []string{"Content-Type", "Authorization", "X-Requested-With", "X-Audit-Reason", "X-HostBoost-Token", "X-HostBoost-Timestamp", "X-HostBoost-Signature"},
 			ExposeHeaders:    []string{"Content-Length"},
 			AllowCredentials: false,
 			MaxAge:           "12h",
 		},
+		CDN: CDNConfig{
+			DefaultType: "cloudflare",
+			Ranges: map[string][]string{
+				"cloudflare": {
+					"173.245.48.0/20", "103.21.244.0/22", "103.22.200.0/22", "103.31.4.0/22",
+					"141.101.64.0/18", "108.162.192.0/18", "190.93.240.0/20", "188.114.96.0/20",
+					"197.234.240.0/22", "198.41.128.0/17", "162.158.0.0/15", "104.16.0.0/13",
+					"104.24.0.0/14", "172.64.0.0/13", "131.0.72.0/22",
+					"2400:cb00::/32", "2606:4700::/32", "2803:f800::/32", "2405:b500::/32",
+					"2405:8100::/32", "2a06:98c0::/29", "2c0f:f248::/32",
+				},
+				"fastly": {
+					"23.235.32.0/20", "43.249.72.0/22", "103.244.50.0/24", "103.245.222.0/23",
+					"103.245.224.0/24", "104.156.80.0/20", "140.248.64.0/18", "140.248.128.0/17",
+					"146.75.0.0/17", "151.101.0.0/16", "157.52.64.0/18", "167.82.0.0/17",
+					"167.82.128.0/20", "167.82.160.0/20", "167.82.224.0/20", "172.111.64.0/18",
+					"185.31.16.0/22", "199.27.72.0/21", "199.232.0.0/16",
+					"2a04:4e40::/32", "2a04:4e42::/32",
+				},
+				"cloudfront": {
+					"13.32.0.0/15", "13.224.0.0/14", "13.249.0.0/16", "18.64.0.0/14",
+					"18.154.0.0/15", "18.160.0.0/15", "18.164.0.0/15", "18.172.0.0/15",
+					"52.84.0.0/15", "54.182.0.0/16", "54.192.0.0/16", "54.230.0.0/16",
+					"54.239.128.0/18", "99.84.0.0/16", "108.156.0.0/14", "143.204.0.0/16",
+					"204.246.164.0/22", "205.251.192.0/19",
+					"2600:9000::/28",
+				},
+				"gcore": {
+					"5.188.4.0/22", "45.82.100.0/22", "92.38.128.0/18", "92.223.64.0/18",
+					"93.123.11.0/24", "185.101.136.0/22", "195.14.144.0/22",
+					"2a03:90c0::/32",
+				},
+			},
+		},
+		Failover: FailoverConfig{
+			Enabled:   true,
+			Fallbacks: 2,
+			Interval:  "1m",
+			Timeout:   "5s",
+		},
+		Health: HealthConfig{
+			Enabled:    true,
+			Interval:   "1m",
+			Timeout:    "5s",
+			MaxLatency: "1s",
+			Failures:   3,
+		},
+		Expiry: ExpiryConfig{
+			CheckInterval: "30s",
+		},
+		Revision: RevisionConfig{
+			Keep: 100,
+		},
+		History: HistoryConfig{
+			Retention: "720h",
+		},
+		Opt: OptConfig{
+			QuarantineCooldown: "24h",
+			MaxAge:             "72h",
+			MinPool:            2,
+			CheckInterval:      "10m",
+			Reoptimize: ReoptimizeConfig{
+				Cooldown: "1h",
+				Timeout:  "30m",
+			},
+			ReportMode: "replace",
+			Merge: MergeConfig{
+				EntryMaxAge: "24h",
+				MaxPool:     10,
+				Weights: ScoreWeights{
+					Delay: 1,
+					Speed: 10,
+					Loss:  5,
+					Age:   2,
+				},
+			},
+		},
+		Auth: AuthConfig{
+			Enabled:   true,
+			TokenFile: "data/auth_token",
+		},
+		Sync: SyncConfig{
+			SystemHosts: true,
+			Reconcile: ReconcileConfig{
+				Enabled:  true,
+				Interval: "1m",
+				Repair:   true,
+			},
+			Targets: SyncTargetsConfig{
+				Dnsmasq: SyncTargetConfig{Path: "/etc/dnsmasq.d/hostboost.conf"},
+				Unbound: SyncTargetConfig{Path: "/etc/unbound/unbound.conf.d/hostboost.conf"},
+				CoreDNS: SyncTargetConfig{Path: "/etc/coredns/hostboost.hosts"},
+				AdGuard: SyncTargetConfig{Path: "/opt/AdGuardHome/hostboost.txt"},
+			},
+		},
+		DNS: DNSConfig{
+			Listen:    ":53",
+			Upstreams: []string{"223.5.5.5:53", "1.1.1.1:53"},
+			Timeout:   "3s",
+			TTL:       30,
+		},
 	}
 }
 
@@ -75,7 +334,8 @@ func Load(path string) (*Config, error) {
 		return nil, fmt.Errorf("failed to read config file: %w", err)
 	}
 
-	cfg := &Config{}
+	// 以默认配置为基础解析，保证旧配置文件缺失的字段使用默认值
+	cfg := DefaultConfig()
 	if err := yaml.Unmarshal(data, cfg); err != nil {
 		return nil, fmt.Errorf("failed to parse config file: %w", err)
 	}
@@ -105,3 +365,138 @@ func (c *CORSConfig) GetMaxAge() time.Duration {
 	}
 	return duration
 }
+
+// GetInterval 解析并返回故障检测周期
+func (c *FailoverConfig) GetInterval() time.Duration {
+	duration, err := time.ParseDuration(c.Interval)
+	if err != nil || duration <= 0 {
+		return time.Minute // 默认值
+	}
+	return duration
+}
+
+// GetTimeout 解析并返回 TLS 握手超时时间
+func (c *FailoverConfig) GetTimeout() time.Duration {
+	duration, err := time.ParseDuration(c.Timeout)
+	if err != nil || duration <= 0 {
+		return 5 * time.Second // 默认值
+	}
+	return duration
+}
+
+// GetInterval 解析并返回健康检测周期
+func (c *HealthConfig) GetInterval() time.Duration {
+	duration, err := time.ParseDuration(c.Interval)
+	if err != nil || duration <= 0 {
+		return time.Minute // 默认值
+	}
+	return duration
+}
+
+// GetTimeout 解析并返回单步探测超时时间
+func (c *HealthConfig) GetTimeout() time.Duration {
+	duration, err := time.ParseDuration(c.Timeout)
+	if err != nil || duration <= 0 {
+		return 5 * time.Second // 默认值
+	}
+	return duration
+}
+
+// GetMaxLatency 解析并返回延迟阈值, 0 表示不检查延迟
+func (c *HealthConfig) GetMaxLatency() time.Duration {
+	duration, err := time.ParseDuration(c.MaxLatency)
+	if err != nil || duration < 0 {
+		return time.Second // 默认值
+	}
+	return duration
+}
+
+// GetTimeout 解析并返回上游 DNS 查询超时时间
+func (c *DNSConfig) GetTimeout() time.Duration {
+	duration, err := time.ParseDuration(c.Timeout)
+	if err != nil || duration <= 0 {
+		return 3 * time.Second // 默认值
+	}
+	return duration
+}
+
+// GetInterval 解析并返回管理区域检查周期
+func (c *ReconcileConfig) GetInterval() time.Duration {
+	duration, err := time.ParseDuration(c.Interval)
+	if err != nil || duration <= 0 {
+		return time.Minute // 默认值
+	}
+	return duration
+}
+
+// GetCheckInterval 解析并返回过期检查周期
+func (c *ExpiryConfig) GetCheckInterval() time.Duration {
+	duration, err := time.ParseDuration(c.CheckInterval)
+	if err != nil || duration <= 0 {
+		return 30 * time.Second // 默认值
+	}
+	return duration
+}
+
+// GetRetention 解析并返回上报历史保留时长, 0 表示永久保留
+func (c *HistoryConfig) GetRetention() time.Duration {
+	duration, err := time.ParseDuration(c.Retention)
+	if err != nil || duration < 0 {
+		return 30 * 24 * time.Hour // 默认值
+	}
+	return duration
+}
+
+// GetQuarantineCooldown 解析并返回 IP 隔离时长, 0 表示不隔离
+func (c *OptConfig) GetQuarantineCooldown() time.Duration {
+	duration, err := time.ParseDuration(c.QuarantineCooldown)
+	if err != nil || duration < 0 {
+		return 24 * time.Hour // 默认值
+	}
+	return duration
+}
+
+// GetMaxAge 解析并返回优选数据的最大有效期, 0 表示不检查
+func (c *OptConfig) GetMaxAge() time.Duration {
+	duration, err := time.ParseDuration(c.MaxAge)
+	if err != nil || duration < 0 {
+		return 72 * time.Hour // 默认值
+	}
+	return duration
+}
+
+// GetCheckInterval 解析并返回过期与存量检查周期
+func (c *OptConfig) GetCheckInterval() time.Duration {
+	duration, err := time.ParseDuration(c.CheckInterval)
+	if err != nil || duration <= 0 {
+		return 10 * time.Minute // 默认值
+	}
+	return duration
+}
+
+// GetCooldown 解析并返回两次自动触发重新优选的最小间隔
+func (c *ReoptimizeConfig) GetCooldown() time.Duration {
+	duration, err := time.ParseDuration(c.Cooldown)
+	if err != nil || duration < 0 {
+		return time.Hour // 默认值
+	}
+	return duration
+}
+
+// GetTimeout 解析并返回重新优选命令的最长运行时间
+func (c *ReoptimizeConfig) GetTimeout() time.Duration {
+	duration, err := time.ParseDuration(c.Timeout)
+	if err != nil || duration <= 0 {
+		return 30 * time.Minute // 默认值
+	}
+	return duration
+}
+
+// GetEntryMaxAge 解析并返回合并时 IP 的最大测速时长, 0 表示不淘汰
+func (c *MergeConfig) GetEntryMaxAge() time.Duration {
+	duration, err := time.ParseDuration(c.EntryMaxAge)
+	if err != nil || duration < 0 {
+		return 24 * time.Hour // 默认值
+	}
+	return duration
+}
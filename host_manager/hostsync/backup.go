@@ -1,6 +1,7 @@
 package hostsync
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -145,6 +146,9 @@ func (s *Syncer) ListBackups() ([]string, error) {
 
 // RestoreFromBackup restores the system hosts file from a backup
 func (s *Syncer) RestoreFromBackup(backupName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	backupDir := s.getBackupDir()
 	backupPath := filepath.Join(backupDir, backupName)
 
@@ -160,8 +164,8 @@ func (s *Syncer) RestoreFromBackup(backupName string) error {
 	}
 
 	// Write to system hosts file
-	if err := os.WriteFile(s.systemHostsPath, backupContent, 0644); err != nil {
-		if os.IsPermission(err) {
+	if err := s.replaceSystemHosts(backupContent); err != nil {
+		if errors.Is(err, ErrPermissionDenied) {
 			return ErrPermissionDenied
 		}
 		return fmt.Errorf("failed to restore hosts file: %w", err)
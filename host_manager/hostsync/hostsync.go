@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"os"
 	"runtime"
+	"sync"
+	"time"
 )
 
 var (
@@ -19,9 +21,27 @@ var (
 
 // HostEntry represents a single host entry
 type HostEntry struct {
-	Domain string `json:"domain"`
-	IP     string `json:"ip"`
-	Type   string `json:"type"`
+	Domain string   `json:"domain"`
+	IP     string   `json:"ip"`
+	IPs    []string `json:"ips,omitempty"` // ordered IP list, primary first
+	Type   string   `json:"type"`
+	// Subdomains lists the labels a pattern entry ("*.example.com") expands to
+	Subdomains []string `json:"subdomains,omitempty"`
+	// Enabled is false for hosts switched off; they are left out of the managed section
+	Enabled bool `json:"enabled"`
+	// ExpiresAt is set for time-limited entries; expired entries are not written
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// UnmarshalJSON defaults Enabled to true for entries written before the flag existed
+func (e *HostEntry) UnmarshalJSON(data []byte) error {
+	type plain HostEntry
+	decoded := plain{Enabled: true}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	*e = HostEntry(decoded)
+	return nil
 }
 
 // Syncer handles synchronization between hosts.json and system hosts file
@@ -30,6 +50,16 @@ type Syncer struct {
 	systemHostsPath   string
 	backupEnabled     bool
 	autoFlushDNSCache bool
+	// entrySource replaces reading hosts.json when the hosts live in another store
+	entrySource func() ([]HostEntry, error)
+	// targets receive the managed entries after the system hosts file is written
+	targets []Target
+	// skipSystemHosts is set when only the targets are written, e.g. on a
+	// resolver box whose own hosts file must stay untouched
+	skipSystemHosts bool
+	// mu serializes syncs with the reads of the system hosts file, since the
+	// API and the background loops all sync concurrently
+	mu sync.Mutex
 }
 
 // NewSyncer creates a new Syncer instance
@@ -52,14 +82,71 @@ func (s *Syncer) SetAutoFlushDNSCache(enabled bool) {
 	s.autoFlushDNSCache = enabled
 }
 
+// SetSystemHostsEnabled enables or disables writing the system hosts file.
+// When disabled, Sync only writes the targets.
+func (s *Syncer) SetSystemHostsEnabled(enabled bool) {
+	s.skipSystemHosts = !enabled
+}
+
+// SetEntrySource makes the syncer read managed entries from source instead of
+// hosts.json, e.g. when hosts are stored in a database
+func (s *Syncer) SetEntrySource(source func() ([]HostEntry, error)) {
+	s.entrySource = source
+}
+
 // Sync reads hosts.json and synchronizes entries to system hosts file
 func (s *Syncer) Sync() error {
-	// Read hosts.json
-	entries, err := s.readHostsJSON()
+	return s.syncWith(nil)
+}
+
+// syncWith performs a sync, optionally rewriting the non-managed lines with
+// transform before they are written back
+func (s *Syncer) syncWith(transform func(otherLines []string) []string) error {
+	changed, err := s.syncLocked(transform)
+
+	// Reload the changed targets once the lock is released
+	s.reloadTargets(changed)
+	return err
+}
+
+// syncLocked writes the system hosts file and the targets under s.mu and
+// returns the targets that changed
+func (s *Syncer) syncLocked(transform func(otherLines []string) []string) ([]Target, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Read hosts.json (or the configured entry source)
+	entries, err := s.managedEntries()
 	if err != nil {
-		return fmt.Errorf("failed to read hosts.json: %w", err)
+		return nil, err
+	}
+
+	var hostsErr error
+	if !s.skipSystemHosts {
+		hostsErr = s.syncSystemHosts(entries, transform)
+	}
+
+	// Write the same entries to the configured resolver targets, even when the
+	// system hosts file could not be written
+	changed := s.applyTargets(entries)
+
+	if hostsErr != nil || s.skipSystemHosts {
+		return changed, hostsErr
 	}
 
+	// Flush DNS cache after successful sync if enabled
+	if s.autoFlushDNSCache {
+		if err := s.FlushDNSCache(); err != nil {
+			// Log warning but don't fail the sync operation
+			fmt.Printf("Warning: failed to flush DNS cache: %v\n", err)
+		}
+	}
+
+	return changed, nil
+}
+
+// syncSystemHosts replaces the managed section of the system hosts file with entries
+func (s *Syncer) syncSystemHosts(entries []HostEntry, transform func(otherLines []string) []string) error {
 	// Create backup if enabled
 	if s.backupEnabled {
 		if err := s.createBackup(); err != nil {
@@ -72,28 +159,56 @@ func (s *Syncer) Sync() error {
 	if err != nil {
 		return fmt.Errorf("failed to parse system hosts file: %w", err)
 	}
+	if transform != nil {
+		otherLines = transform(otherLines)
+	}
 
 	// Write back to system hosts file (completely replace managed section with entries from hosts.json)
 	if err := s.writeSystemHosts(entries, otherLines); err != nil {
 		return fmt.Errorf("failed to write system hosts file: %w", err)
 	}
 
-	// Flush DNS cache after successful sync if enabled
-	if s.autoFlushDNSCache {
-		if err := s.FlushDNSCache(); err != nil {
-			// Log warning but don't fail the sync operation
-			fmt.Printf("Warning: failed to flush DNS cache: %v\n", err)
-		}
-	}
-
 	return nil
 }
 
+// managedEntries returns the entries written to the managed section: disabled
+// or expired entries are left out and pattern entries expanded into concrete domains
+func (s *Syncer) managedEntries() ([]HostEntry, error) {
+	entries, err := s.readEntries()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read hosts.json: %w", err)
+	}
+	return expandEntries(activeEntries(entries, time.Now())), nil
+}
+
 // SyncFromJSON reads hosts.json and returns the entries without modifying system hosts
 func (s *Syncer) SyncFromJSON() ([]HostEntry, error) {
+	return s.readEntries()
+}
+
+// readEntries returns the managed entries from the entry source if set, otherwise from hosts.json
+func (s *Syncer) readEntries() ([]HostEntry, error) {
+	if s.entrySource != nil {
+		return s.entrySource()
+	}
 	return s.readHostsJSON()
 }
 
+// activeEntries filters out entries that have been switched off or have expired
+func activeEntries(entries []HostEntry, now time.Time) []HostEntry {
+	result := make([]HostEntry, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.Enabled {
+			continue
+		}
+		if entry.ExpiresAt != nil && !entry.ExpiresAt.After(now) {
+			continue
+		}
+		result = append(result, entry)
+	}
+	return result
+}
+
 // readHostsJSON reads and parses the hosts.json file
 func (s *Syncer) readHostsJSON() ([]HostEntry, error) {
 	data, err := os.ReadFile(s.hostsJSONPath)
@@ -2,9 +2,14 @@ package hostsync
 
 import (
 	"bufio"
+	"bytes"
+	"errors"
 	"fmt"
+	"net"
 	"os"
 	"strings"
+	"syscall"
+	"time"
 )
 
 const (
@@ -103,82 +108,174 @@ func parseHostLine(line string) *HostEntry {
 	}
 }
 
-// writeSystemHosts writes entries and other lines back to system hosts file
-func (s *Syncer) writeSystemHosts(entries []HostEntry, otherLines []string) error {
-	// Create a temporary file
-	tempFile, err := os.CreateTemp("", "hosts-*.tmp")
-	if err != nil {
-		return fmt.Errorf("failed to create temp file: %w", err)
-	}
-	tempPath := tempFile.Name()
-	defer os.Remove(tempPath) // Clean up temp file
+// LineError describes a hosts line that could not be parsed
+type LineError struct {
+	Line    int    `json:"line"`
+	Content string `json:"content"`
+	Reason  string `json:"reason"`
+}
 
-	writer := bufio.NewWriter(tempFile)
+// ParsedHost is a host entry parsed from text with the line it first appeared on
+type ParsedHost struct {
+	HostEntry
+	Line int
+}
 
-	// Write other lines (non-managed content)
-	for _, line := range otherLines {
-		if _, err := writer.WriteString(line + "\n"); err != nil {
-			tempFile.Close()
-			return fmt.Errorf("failed to write line: %w", err)
-		}
-	}
+// ParseHostsText parses hosts file content such as an /etc/hosts snippet.
+// Comments, blank lines and section markers are skipped. Repeated lines for the
+// same domain are merged into one entry whose IPs keep the order they appeared in.
+// Lines that cannot be parsed are reported with their 1-based line numbers.
+func ParseHostsText(text string) ([]ParsedHost, []LineError) {
+	var entries []ParsedHost
+	var lineErrors []LineError
+	index := make(map[string]int)
 
-	// Write managed section
-	if len(entries) > 0 {
-		// Add a newline before managed section if otherLines doesn't end with empty line
-		if len(otherLines) > 0 && strings.TrimSpace(otherLines[len(otherLines)-1]) != "" {
-			writer.WriteString("\n")
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
 		}
 
-		// Write managed section start marker
-		writer.WriteString(managedSectionStart + "\n")
+		entry := parseHostLine(trimmed)
+		if entry == nil {
+			lineErrors = append(lineErrors, LineError{Line: lineNo, Content: line, Reason: "expected \"<ip> <domain>\""})
+			continue
+		}
+		if net.ParseIP(entry.IP) == nil {
+			lineErrors = append(lineErrors, LineError{Line: lineNo, Content: line, Reason: fmt.Sprintf("invalid ip %q", entry.IP)})
+			continue
+		}
 
-		// Write managed entries
-		for _, entry := range entries {
-			line := formatHostEntry(entry)
-			if _, err := writer.WriteString(line + "\n"); err != nil {
-				tempFile.Close()
-				return fmt.Errorf("failed to write entry: %w", err)
+		if i, ok := index[entry.Domain]; ok {
+			if !containsIP(entries[i].IPs, entry.IP) {
+				entries[i].IPs = append(entries[i].IPs, entry.IP)
+			}
+			if entries[i].Type == "" {
+				entries[i].Type = entry.Type
 			}
+			continue
 		}
 
-		// Write managed section end marker
-		writer.WriteString(managedSectionEnd + "\n")
+		entry.IPs = []string{entry.IP}
+		entry.Enabled = true
+		index[entry.Domain] = len(entries)
+		entries = append(entries, ParsedHost{HostEntry: *entry, Line: lineNo})
 	}
 
-	// Flush and close temp file
-	if err := writer.Flush(); err != nil {
-		tempFile.Close()
-		return fmt.Errorf("failed to flush writer: %w", err)
+	if err := scanner.Err(); err != nil {
+		lineErrors = append(lineErrors, LineError{Line: lineNo + 1, Reason: err.Error()})
 	}
-	tempFile.Close()
 
-	// Copy temp file to system hosts file
-	if err := copyFile(tempPath, s.systemHostsPath); err != nil {
-		return fmt.Errorf("failed to copy temp file to hosts file: %w", err)
+	return entries, lineErrors
+}
+
+// RenderEntries returns the managed hosts lines exactly as Sync would write them:
+// disabled and expired entries are left out and patterns are expanded
+func RenderEntries(entries []HostEntry, now time.Time) []string {
+	var lines []string
+	for _, entry := range expandEntries(activeEntries(entries, now)) {
+		lines = append(lines, strings.Split(formatHostEntry(entry), "\n")...)
 	}
+	return lines
+}
 
-	return nil
+func containsIP(ips []string, ip string) bool {
+	for _, existing := range ips {
+		if existing == ip {
+			return true
+		}
+	}
+	return false
 }
 
-// formatHostEntry formats a HostEntry as a hosts file line
-func formatHostEntry(entry HostEntry) string {
-	line := fmt.Sprintf("%-15s %s", entry.IP, entry.Domain)
-	if entry.Type != "" {
-		line += fmt.Sprintf(" # type:%s", entry.Type)
+// writeSystemHosts writes entries and other lines back to system hosts file.
+// The file is replaced through a temporary file in the same directory, so
+// other readers never see it half written.
+func (s *Syncer) writeSystemHosts(entries []HostEntry, otherLines []string) error {
+	var buf bytes.Buffer
+	for _, line := range renderSystemHosts(entries, otherLines) {
+		buf.WriteString(line)
+		buf.WriteByte('\n')
 	}
-	return line
+
+	return s.replaceSystemHosts(buf.Bytes())
 }
 
-// copyFile copies a file from src to dst
-func copyFile(src, dst string) error {
-	input, err := os.ReadFile(src)
-	if err != nil {
-		return err
+// replaceSystemHosts atomically replaces the system hosts file with content,
+// keeping the permissions of the existing file
+func (s *Syncer) replaceSystemHosts(content []byte) error {
+	perm := os.FileMode(0644)
+	if info, err := os.Stat(s.systemHostsPath); err == nil {
+		perm = info.Mode().Perm()
+	}
+
+	err := writeFileAtomic(s.systemHostsPath, content, perm)
+	if errors.Is(err, syscall.EBUSY) || errors.Is(err, syscall.EXDEV) {
+		// A bind-mounted hosts file, as in containers, cannot be replaced by
+		// a rename and has to be rewritten in place
+		err = writeFileInPlace(s.systemHostsPath, content, perm)
+	}
+	return err
+}
+
+// renderSystemHosts returns the lines of the system hosts file: the non-managed
+// content followed by the managed section holding entries
+func renderSystemHosts(entries []HostEntry, otherLines []string) []string {
+	// Keep other lines (non-managed content) as-is
+	lines := append([]string{}, otherLines...)
+
+	if len(entries) == 0 {
+		return lines
+	}
+
+	// Add an empty line before managed section if otherLines doesn't end with one
+	if len(otherLines) > 0 && strings.TrimSpace(otherLines[len(otherLines)-1]) != "" {
+		lines = append(lines, "")
+	}
+
+	lines = append(lines, managedSectionStart)
+	for _, entry := range entries {
+		lines = append(lines, strings.Split(formatHostEntry(entry), "\n")...)
 	}
+	lines = append(lines, managedSectionEnd)
+
+	return lines
+}
+
+// formatHostEntry formats a HostEntry as hosts file lines, one per IP.
+// The primary IP comes first so resolvers that stop at the first match use it.
+func formatHostEntry(entry HostEntry) string {
+	ips := entry.IPs
+	if len(ips) == 0 {
+		ips = []string{entry.IP}
+	}
+
+	lines := make([]string, 0, len(ips))
+	for i, ip := range ips {
+		var tags []string
+		if entry.Type != "" {
+			tags = append(tags, "type:"+entry.Type)
+		}
+		if i > 0 {
+			tags = append(tags, "fallback")
+		}
+
+		line := fmt.Sprintf("%-15s %s", ip, entry.Domain)
+		if len(tags) > 0 {
+			line += " # " + strings.Join(tags, " ")
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
 
-	// Write with appropriate permissions (644 for hosts file)
-	if err := os.WriteFile(dst, input, 0644); err != nil {
+// writeFileInPlace truncates and rewrites path with content
+func writeFileInPlace(path string, content []byte, perm os.FileMode) error {
+	if err := os.WriteFile(path, content, perm); err != nil {
 		if os.IsPermission(err) {
 			return ErrPermissionDenied
 		}
@@ -0,0 +1,61 @@
+package hostsync
+
+import "strings"
+
+const (
+	// wildcardPrefix marks a pattern entry such as "*.example.com"
+	wildcardPrefix = "*."
+	// apexLabel expands to the pattern's base domain itself
+	apexLabel = "@"
+)
+
+// IsPattern reports whether the domain is a wildcard pattern entry
+func IsPattern(domain string) bool {
+	return strings.HasPrefix(domain, wildcardPrefix)
+}
+
+// ExpandDomain returns the concrete domains covered by an entry.
+// Pattern entries ("*.example.com") are expanded with the given subdomain labels,
+// "@" standing for the base domain. Plain domains are returned as-is.
+func ExpandDomain(domain string, subdomains []string) []string {
+	if !IsPattern(domain) {
+		return []string{domain}
+	}
+
+	base := strings.TrimPrefix(domain, wildcardPrefix)
+	result := make([]string, 0, len(subdomains))
+	seen := make(map[string]bool, len(subdomains))
+	for _, sub := range subdomains {
+		name := base
+		if sub != apexLabel {
+			name = sub + "." + base
+		}
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		result = append(result, name)
+	}
+
+	return result
+}
+
+// expandEntries replaces pattern entries with one entry per concrete domain,
+// since hosts files cannot express wildcards
+func expandEntries(entries []HostEntry) []HostEntry {
+	result := make([]HostEntry, 0, len(entries))
+	for _, entry := range entries {
+		if !IsPattern(entry.Domain) {
+			result = append(result, entry)
+			continue
+		}
+
+		for _, domain := range ExpandDomain(entry.Domain, entry.Subdomains) {
+			expanded := entry
+			expanded.Domain = domain
+			expanded.Subdomains = nil
+			result = append(result, expanded)
+		}
+	}
+	return result
+}
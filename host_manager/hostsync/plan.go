@@ -0,0 +1,231 @@
+package hostsync
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines shown around each change
+const diffContext = 3
+
+// maxDiffCells bounds the LCS table; larger changed regions are shown as a
+// whole-block replacement instead
+const maxDiffCells = 1 << 22
+
+// SyncPlan describes what Sync would write to the system hosts file
+type SyncPlan struct {
+	Path    string `json:"path"`    // system hosts file path
+	Changed bool   `json:"changed"` // whether Sync would modify the file
+	Added   int    `json:"added"`   // number of lines that would be added
+	Removed int    `json:"removed"` // number of lines that would be removed
+	Diff    string `json:"diff"`    // unified diff from the current to the planned content, empty when unchanged
+}
+
+// Plan computes the system hosts file Sync would write and returns its unified
+// diff against the current file. Nothing is written, backed up or flushed.
+func (s *Syncer) Plan() (*SyncPlan, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, err := s.managedEntries()
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := s.readSystemHostsLines()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read system hosts file: %w", err)
+	}
+
+	_, otherLines, err := s.parseSystemHosts()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse system hosts file: %w", err)
+	}
+	planned := renderSystemHosts(entries, otherLines)
+
+	ops := diffLines(current, planned)
+	plan := &SyncPlan{Path: s.systemHostsPath}
+	for _, op := range ops {
+		switch op.kind {
+		case '+':
+			plan.Added++
+		case '-':
+			plan.Removed++
+		}
+	}
+	plan.Changed = plan.Added > 0 || plan.Removed > 0
+	if plan.Changed {
+		plan.Diff = formatUnified(s.systemHostsPath, s.systemHostsPath+" (planned)", ops)
+	}
+
+	return plan, nil
+}
+
+// readSystemHostsLines returns the lines of the system hosts file, empty if it does not exist
+func (s *Syncer) readSystemHostsLines() ([]string, error) {
+	file, err := os.Open(s.systemHostsPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []string{}, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return lines, scanner.Err()
+}
+
+// diffOp is one line of an edit script: ' ' kept, '-' removed from a, '+' added from b
+type diffOp struct {
+	kind byte
+	text string
+	a, b int // 0-based position in a and b before this line
+}
+
+// diffLines returns an edit script turning a into b
+func diffLines(a, b []string) []diffOp {
+	// Strip the common prefix and suffix, the managed section is usually a small part of the file
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	ops := make([]diffOp, 0, len(a)+len(b)-prefix-suffix)
+	for i := 0; i < prefix; i++ {
+		ops = append(ops, diffOp{kind: ' ', text: a[i], a: i, b: i})
+	}
+	ops = append(ops, diffMiddle(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix], prefix, prefix)...)
+	for i := 0; i < suffix; i++ {
+		ai, bi := len(a)-suffix+i, len(b)-suffix+i
+		ops = append(ops, diffOp{kind: ' ', text: a[ai], a: ai, b: bi})
+	}
+	return ops
+}
+
+// diffMiddle diffs the changed region with a longest common subsequence table
+func diffMiddle(a, b []string, offsetA, offsetB int) []diffOp {
+	var ops []diffOp
+	if len(a)*len(b) > maxDiffCells {
+		for i, line := range a {
+			ops = append(ops, diffOp{kind: '-', text: line, a: offsetA + i, b: offsetB})
+		}
+		for j, line := range b {
+			ops = append(ops, diffOp{kind: '+', text: line, a: offsetA + len(a), b: offsetB + j})
+		}
+		return ops
+	}
+
+	// lcs[i][j] is the LCS length of a[i:] and b[j:]
+	width := len(b) + 1
+	lcs := make([]int32, (len(a)+1)*width)
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i*width+j] = lcs[(i+1)*width+j+1] + 1
+			} else if lcs[(i+1)*width+j] >= lcs[i*width+j+1] {
+				lcs[i*width+j] = lcs[(i+1)*width+j]
+			} else {
+				lcs[i*width+j] = lcs[i*width+j+1]
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			ops = append(ops, diffOp{kind: ' ', text: a[i], a: offsetA + i, b: offsetB + j})
+			i++
+			j++
+		case j == len(b) || (i < len(a) && lcs[(i+1)*width+j] >= lcs[i*width+j+1]):
+			ops = append(ops, diffOp{kind: '-', text: a[i], a: offsetA + i, b: offsetB + j})
+			i++
+		default:
+			ops = append(ops, diffOp{kind: '+', text: b[j], a: offsetA + i, b: offsetB + j})
+			j++
+		}
+	}
+	return ops
+}
+
+// UnifiedDiff returns the unified diff between the lines of a and b, labelled
+// fromName and toName, or an empty string when they are equal
+func UnifiedDiff(fromName, toName string, a, b []string) string {
+	return formatUnified(fromName, toName, diffLines(a, b))
+}
+
+// formatUnified renders an edit script as unified diff hunks
+func formatUnified(fromName, toName string, ops []diffOp) string {
+	var out strings.Builder
+	for start := 0; start < len(ops); {
+		// Find the next change
+		first := start
+		for first < len(ops) && ops[first].kind == ' ' {
+			first++
+		}
+		if first == len(ops) {
+			break
+		}
+
+		// Extend the hunk while changes are close enough to share context
+		last := first
+		for k := first; k < len(ops); k++ {
+			if ops[k].kind != ' ' {
+				last = k
+			} else if k-last > 2*diffContext {
+				break
+			}
+		}
+
+		from := max(first-diffContext, start)
+		to := min(last+diffContext+1, len(ops))
+
+		if out.Len() == 0 {
+			fmt.Fprintf(&out, "--- %s\n+++ %s\n", fromName, toName)
+		}
+		writeHunk(&out, ops[from:to])
+		start = to
+	}
+
+	return out.String()
+}
+
+// writeHunk writes one "@@ -a,n +b,m @@" hunk
+func writeHunk(out *strings.Builder, ops []diffOp) {
+	countA, countB := 0, 0
+	for _, op := range ops {
+		if op.kind != '+' {
+			countA++
+		}
+		if op.kind != '-' {
+			countB++
+		}
+	}
+
+	// Empty ranges point at the line before the insertion, as in diff -u
+	startA, startB := ops[0].a, ops[0].b
+	if countA > 0 {
+		startA++
+	}
+	if countB > 0 {
+		startB++
+	}
+
+	fmt.Fprintf(out, "@@ -%d,%d +%d,%d @@\n", startA, countA, startB, countB)
+	for _, op := range ops {
+		out.WriteByte(op.kind)
+		out.WriteString(op.text)
+		out.WriteByte('\n')
+	}
+}
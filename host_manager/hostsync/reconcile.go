@@ -0,0 +1,322 @@
+package hostsync
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxDriftEvents is the number of drift events kept for status reports
+	maxDriftEvents = 20
+	// driftConfirmDelay is how long a drift must persist before it is reported.
+	// Changes made through host_manager update the store just before syncing,
+	// so a check landing in between would otherwise see a false drift.
+	driftConfirmDelay = 2 * time.Second
+)
+
+// Drift describes how the managed section of the system hosts file differs
+// from the managed entries. Lines are "<ip> <domain>".
+type Drift struct {
+	Missing    []string `json:"missing,omitempty"`    // expected lines absent from the section
+	Unexpected []string `json:"unexpected,omitempty"` // lines in the section that should not be there
+	Reordered  bool     `json:"reordered,omitempty"`  // same lines in another order, e.g. a fallback before the primary
+}
+
+// Drifted reports whether the section differs from the entries
+func (d *Drift) Drifted() bool {
+	return len(d.Missing) > 0 || len(d.Unexpected) > 0 || d.Reordered
+}
+
+// String summarizes the drift for logs
+func (d *Drift) String() string {
+	var parts []string
+	if len(d.Missing) > 0 {
+		parts = append(parts, fmt.Sprintf("%d line(s) missing", len(d.Missing)))
+	}
+	if len(d.Unexpected) > 0 {
+		parts = append(parts, fmt.Sprintf("%d unexpected line(s)", len(d.Unexpected)))
+	}
+	if d.Reordered {
+		parts = append(parts, "lines reordered")
+	}
+	return strings.Join(parts, ", ")
+}
+
+// key identifies the drift so a persisting one is reported only once
+func (d *Drift) key() string {
+	return fmt.Sprintf("%q %q %v", d.Missing, d.Unexpected, d.Reordered)
+}
+
+// CheckDrift compares the managed section parsed from the system hosts file
+// with the managed entries, without changing anything
+func (s *Syncer) CheckDrift() (*Drift, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, err := s.managedEntries()
+	if err != nil {
+		return nil, err
+	}
+
+	actualEntries, _, err := s.parseSystemHosts()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse system hosts file: %w", err)
+	}
+
+	var expected []string
+	for _, entry := range entries {
+		ips := entry.IPs
+		if len(ips) == 0 {
+			ips = []string{entry.IP}
+		}
+		for _, ip := range ips {
+			expected = append(expected, ip+" "+entry.Domain)
+		}
+	}
+
+	actual := make([]string, 0, len(actualEntries))
+	for _, entry := range actualEntries {
+		actual = append(actual, entry.IP+" "+entry.Domain)
+	}
+
+	drift := &Drift{
+		Missing:    subtractLines(expected, actual),
+		Unexpected: subtractLines(actual, expected),
+	}
+	if len(drift.Missing) == 0 && len(drift.Unexpected) == 0 {
+		drift.Reordered = strings.Join(expected, "\n") != strings.Join(actual, "\n")
+	}
+	return drift, nil
+}
+
+// subtractLines returns the lines of a not matched by a line of b, counting duplicates
+func subtractLines(a, b []string) []string {
+	remaining := make(map[string]int, len(b))
+	for _, line := range b {
+		remaining[line]++
+	}
+
+	var result []string
+	for _, line := range a {
+		if remaining[line] > 0 {
+			remaining[line]--
+			continue
+		}
+		result = append(result, line)
+	}
+	return result
+}
+
+// DriftEvent is a drift detected by the reconciler
+type DriftEvent struct {
+	Time time.Time `json:"time"`
+	Drift
+	Repaired bool   `json:"repaired"`        // whether the section was rewritten
+	Error    string `json:"error,omitempty"` // why the repair failed
+}
+
+// ReconcileStatus reports the current state of the managed section and the
+// drift detected so far
+type ReconcileStatus struct {
+	Running    bool         `json:"running"`  // whether the reconcile loop is running
+	Interval   string       `json:"interval"` // time between two checks
+	Repair     bool         `json:"repair"`   // whether drift is repaired or only reported
+	InSync     bool         `json:"in_sync"`  // result of a check made for this status
+	Drift      *Drift       `json:"drift,omitempty"`
+	Error      string       `json:"error,omitempty"` // why the check failed
+	LastCheck  *time.Time   `json:"last_check,omitempty"`
+	LastDrift  *DriftEvent  `json:"last_drift,omitempty"`
+	DriftCount int          `json:"drift_count"` // drift events since startup
+	Recent     []DriftEvent `json:"recent"`      // latest drift events, newest first
+}
+
+// Reconciler periodically checks the managed section of the system hosts file
+// and rewrites it when another tool changed or removed it
+type Reconciler struct {
+	syncer   *Syncer
+	interval time.Duration
+	repair   bool
+	onDrift  func(DriftEvent)
+	stop     chan struct{}
+	once     sync.Once
+
+	mu        sync.Mutex
+	running   bool
+	lastCheck *time.Time
+	events    []DriftEvent // oldest first
+	count     int
+	reported  string // drift already reported and not repaired, not reported again
+}
+
+// NewReconciler creates a reconciler for syncer. When repair is false drift
+// is only reported.
+func NewReconciler(syncer *Syncer, interval time.Duration, repair bool) *Reconciler {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	return &Reconciler{
+		syncer:   syncer,
+		interval: interval,
+		repair:   repair,
+		stop:     make(chan struct{}),
+	}
+}
+
+// SetDriftHandler sets a function called for every drift event, e.g. to
+// record it in the audit log
+func (r *Reconciler) SetDriftHandler(fn func(DriftEvent)) {
+	r.onDrift = fn
+}
+
+// Start runs the reconcile loop in a background goroutine
+func (r *Reconciler) Start() {
+	r.mu.Lock()
+	r.running = true
+	r.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				r.CheckOnce()
+			case <-r.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop terminates the reconcile loop
+func (r *Reconciler) Stop() {
+	r.once.Do(func() {
+		r.mu.Lock()
+		r.running = false
+		r.mu.Unlock()
+		close(r.stop)
+	})
+}
+
+// CheckOnce checks the managed section and repairs it if enabled. It returns
+// the drift event, or nil when the section is in sync or the same drift was
+// already reported.
+func (r *Reconciler) CheckOnce() *DriftEvent {
+	drift, ok := r.check()
+	if !ok {
+		return nil
+	}
+	if r.isReported(drift) {
+		return nil
+	}
+
+	// Confirm the drift so a change being synced right now is not reported
+	select {
+	case <-time.After(driftConfirmDelay):
+	case <-r.stop:
+		return nil
+	}
+	drift, ok = r.check()
+	if !ok {
+		return nil
+	}
+	if r.isReported(drift) {
+		return nil
+	}
+
+	event := DriftEvent{Time: time.Now(), Drift: *drift}
+	fmt.Printf("Warning: managed section of %s drifted: %s\n", r.syncer.systemHostsPath, drift)
+
+	if r.repair {
+		if err := r.syncer.Sync(); err != nil {
+			event.Error = err.Error()
+			fmt.Printf("Warning: failed to repair managed section: %v\n", err)
+		} else {
+			event.Repaired = true
+			fmt.Printf("Managed section of %s repaired\n", r.syncer.systemHostsPath)
+		}
+	}
+
+	r.mu.Lock()
+	if !event.Repaired {
+		r.reported = drift.key()
+	}
+	r.count++
+	r.events = append(r.events, event)
+	if len(r.events) > maxDriftEvents {
+		r.events = r.events[len(r.events)-maxDriftEvents:]
+	}
+	r.mu.Unlock()
+
+	if r.onDrift != nil {
+		r.onDrift(event)
+	}
+	return &event
+}
+
+// check runs CheckDrift and returns the drift if there is one
+func (r *Reconciler) check() (*Drift, bool) {
+	drift, err := r.syncer.CheckDrift()
+
+	now := time.Now()
+	r.mu.Lock()
+	r.lastCheck = &now
+	r.mu.Unlock()
+
+	if err != nil {
+		fmt.Printf("Warning: hosts drift check failed: %v\n", err)
+		return nil, false
+	}
+	if !drift.Drifted() {
+		r.mu.Lock()
+		r.reported = ""
+		r.mu.Unlock()
+		return nil, false
+	}
+	return drift, true
+}
+
+// isReported reports whether the same drift was already reported
+func (r *Reconciler) isReported(drift *Drift) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.reported != "" && r.reported == drift.key()
+}
+
+// Status checks the managed section now and returns it with the drift
+// history. The check does not repair anything.
+func (r *Reconciler) Status() ReconcileStatus {
+	drift, err := r.syncer.CheckDrift()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	status := ReconcileStatus{
+		Running:    r.running,
+		Interval:   r.interval.String(),
+		Repair:     r.repair,
+		LastCheck:  r.lastCheck,
+		DriftCount: r.count,
+		Recent:     make([]DriftEvent, 0, len(r.events)),
+	}
+	if err != nil {
+		status.Error = err.Error()
+	} else if drift.Drifted() {
+		status.Drift = drift
+	} else {
+		status.InSync = true
+	}
+
+	for i := len(r.events) - 1; i >= 0; i-- {
+		status.Recent = append(status.Recent, r.events[i])
+	}
+	if len(status.Recent) > 0 {
+		last := status.Recent[0]
+		status.LastDrift = &last
+	}
+	return status
+}
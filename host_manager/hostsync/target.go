@@ -0,0 +1,267 @@
+package hostsync
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Target formats
+const (
+	TargetDnsmasq = "dnsmasq" // dnsmasq conf file of host-record= lines
+	TargetUnbound = "unbound" // unbound include file of local-data records
+	TargetCoreDNS = "coredns" // hosts file read by the CoreDNS hosts plugin
+	TargetAdGuard = "adguard" // AdGuard Home filter list of $dnsrewrite rules
+)
+
+// reloadTimeout bounds a target's reload command
+const reloadTimeout = time.Minute
+
+// Target is a destination besides the system hosts file that receives the
+// managed entries on every sync, such as a LAN resolver's configuration
+type Target interface {
+	// Name identifies the target in logs
+	Name() string
+	// Apply writes the managed entries and reports whether the target
+	// changed. Disabled and expired entries have already been removed and
+	// patterns expanded.
+	Apply(entries []HostEntry) (changed bool, err error)
+	// Reload makes the resolver pick up a changed target. It runs after the
+	// syncer released its lock, so a slow reload does not block other syncs.
+	Reload() error
+}
+
+// FileTarget renders the managed entries into a resolver configuration file
+// and runs an optional reload command whenever the file content changes
+type FileTarget struct {
+	format string
+	path   string
+	reload []string
+	render func(entries []HostEntry) []byte
+}
+
+// NewFileTarget creates a file target of the given format (dnsmasq, unbound,
+// coredns or adguard) written to path. reload, if not empty, is the command
+// and arguments run after the file changed.
+func NewFileTarget(format, path string, reload []string) (*FileTarget, error) {
+	if path == "" {
+		return nil, fmt.Errorf("sync target %s: path is required", format)
+	}
+
+	t := &FileTarget{format: format, path: path, reload: reload}
+	switch format {
+	case TargetDnsmasq:
+		t.render = renderDnsmasq
+	case TargetUnbound:
+		t.render = renderUnbound
+	case TargetCoreDNS:
+		t.render = renderCoreDNS
+	case TargetAdGuard:
+		t.render = renderAdGuard
+	default:
+		return nil, fmt.Errorf("unsupported sync target %q", format)
+	}
+	return t, nil
+}
+
+// Name returns the target format and file
+func (t *FileTarget) Name() string {
+	return t.format + " (" + t.path + ")"
+}
+
+// Apply writes the rendered entries. Nothing is written when the file
+// already has the same content.
+func (t *FileTarget) Apply(entries []HostEntry) (bool, error) {
+	content := t.render(entries)
+
+	current, err := os.ReadFile(t.path)
+	if err == nil && bytes.Equal(current, content) {
+		return false, nil
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+
+	if err := writeFileAtomic(t.path, content, 0644); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Reload runs the reload command, if any
+func (t *FileTarget) Reload() error {
+	if len(t.reload) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), reloadTimeout)
+	defer cancel()
+
+	output, err := exec.CommandContext(ctx, t.reload[0], t.reload[1:]...).CombinedOutput()
+	if err != nil {
+		if out := strings.TrimSpace(string(output)); out != "" {
+			err = fmt.Errorf("%v: %s", err, out)
+		}
+		return fmt.Errorf("reload %q: %w", strings.Join(t.reload, " "), err)
+	}
+	return nil
+}
+
+// SetTargets replaces the targets written after the system hosts file
+func (s *Syncer) SetTargets(targets ...Target) {
+	s.targets = targets
+}
+
+// SyncTargets writes the managed entries to the targets only, leaving the
+// system hosts file alone, e.g. to fill newly configured targets at startup
+func (s *Syncer) SyncTargets() error {
+	s.mu.Lock()
+	entries, err := s.managedEntries()
+	if err != nil {
+		s.mu.Unlock()
+		return err
+	}
+	changed := s.applyTargets(entries)
+	s.mu.Unlock()
+
+	s.reloadTargets(changed)
+	return nil
+}
+
+// applyTargets writes the entries to every target and returns the targets
+// that changed. A failing target is reported but does not stop the others or
+// fail the sync.
+func (s *Syncer) applyTargets(entries []HostEntry) []Target {
+	var changed []Target
+	for _, target := range s.targets {
+		updated, err := target.Apply(entries)
+		if err != nil {
+			fmt.Printf("Warning: failed to sync target %s: %v\n", target.Name(), err)
+		}
+		if updated {
+			changed = append(changed, target)
+		}
+	}
+	return changed
+}
+
+// reloadTargets reloads the targets changed by applyTargets. It is called
+// without holding s.mu.
+func (s *Syncer) reloadTargets(changed []Target) {
+	for _, target := range changed {
+		if err := target.Reload(); err != nil {
+			fmt.Printf("Warning: failed to reload target %s: %v\n", target.Name(), err)
+		}
+	}
+}
+
+// writeFileAtomic replaces path with content through a temporary file in the
+// same directory, so resolvers watching the file never read a partial write
+func writeFileAtomic(path string, content []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	tempFile, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		if os.IsPermission(err) {
+			return fmt.Errorf("%w: %s", ErrPermissionDenied, path)
+		}
+		return err
+	}
+	tempPath := tempFile.Name()
+	defer os.Remove(tempPath) // Clean up if the rename did not happen
+
+	if _, err := tempFile.Write(content); err != nil {
+		tempFile.Close()
+		return err
+	}
+	if err := tempFile.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tempPath, perm); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tempPath, path); err != nil {
+		if os.IsPermission(err) {
+			return fmt.Errorf("%w: %s", ErrPermissionDenied, path)
+		}
+		return err
+	}
+	return nil
+}
+
+// primaryIP returns the IP resolvers should answer with. Fallback IPs are left
+// out: unlike a hosts file, a DNS answer with several records lets clients
+// pick any of them.
+func primaryIP(entry HostEntry) string {
+	if len(entry.IPs) > 0 {
+		return entry.IPs[0]
+	}
+	return entry.IP
+}
+
+// recordType returns "A" or "AAAA" for ip
+func recordType(ip string) string {
+	if parsed := net.ParseIP(ip); parsed != nil && parsed.To4() == nil {
+		return "AAAA"
+	}
+	return "A"
+}
+
+const generatedHeader = "Generated by HostBoost, do not edit: changes are overwritten on every sync"
+
+// renderDnsmasq renders "host-record=domain,ip" lines. Unlike address=,
+// host-record answers for the exact name only, as the hosts file does.
+func renderDnsmasq(entries []HostEntry) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# %s\n", generatedHeader)
+	for _, entry := range entries {
+		fmt.Fprintf(&buf, "host-record=%s,%s\n", entry.Domain, primaryIP(entry))
+	}
+	return buf.Bytes()
+}
+
+// renderUnbound renders a server clause of local-data records, meant to be
+// pulled in with an include: statement
+func renderUnbound(entries []HostEntry) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# %s\nserver:\n", generatedHeader)
+	for _, entry := range entries {
+		ip := primaryIP(entry)
+		fmt.Fprintf(&buf, "\tlocal-data: \"%s. IN %s %s\"\n", entry.Domain, recordType(ip), ip)
+	}
+	return buf.Bytes()
+}
+
+// renderCoreDNS renders a hosts file for the CoreDNS hosts plugin, which
+// reloads it on change by itself
+func renderCoreDNS(entries []HostEntry) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# %s\n", generatedHeader)
+	for _, entry := range entries {
+		fmt.Fprintf(&buf, "%-15s %s\n", primaryIP(entry), entry.Domain)
+	}
+	return buf.Bytes()
+}
+
+// renderAdGuard renders DNS rewrite rules, loadable in AdGuard Home as a
+// custom filter list from a local path. The "|" anchor makes each rule match
+// the exact name only, not its subdomains.
+func renderAdGuard(entries []HostEntry) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "! %s\n", generatedHeader)
+	for _, entry := range entries {
+		ip := primaryIP(entry)
+		fmt.Fprintf(&buf, "|%s^$dnsrewrite=NOERROR;%s;%s\n", entry.Domain, recordType(ip), ip)
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,134 @@
+package hostsync
+
+import (
+	"bufio"
+	"os"
+	"strings"
+)
+
+// UnmanagedEntry is a host line of the system hosts file outside the managed section
+type UnmanagedEntry struct {
+	Line    int      `json:"line"`    // 1-based line number in the system hosts file
+	IP      string   `json:"ip"`      // address the line maps to
+	Domains []string `json:"domains"` // every name on the line, aliases included
+	Content string   `json:"content"` // the raw line
+}
+
+// ListUnmanaged returns the host lines of the system hosts file that are not
+// part of the managed section. Comments and blank lines are skipped.
+func (s *Syncer) ListUnmanaged() ([]UnmanagedEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, err := os.Open(s.systemHostsPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []UnmanagedEntry{}, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	entries := []UnmanagedEntry{}
+	inManagedSection := false
+	lineNo := 0
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lineNo++
+		line := scanner.Text()
+		trimmedLine := strings.TrimSpace(line)
+
+		switch {
+		case trimmedLine == managedSectionStart:
+			inManagedSection = true
+			continue
+		case trimmedLine == managedSectionEnd:
+			inManagedSection = false
+			continue
+		case inManagedSection:
+			continue
+		}
+
+		ip, domains := parseHostFields(trimmedLine)
+		if ip == "" {
+			continue
+		}
+
+		entries = append(entries, UnmanagedEntry{
+			Line:    lineNo,
+			IP:      ip,
+			Domains: domains,
+			Content: line,
+		})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// RemoveUnmanaged removes the given domains from the non-managed part of the
+// system hosts file and re-syncs the managed section in the same write.
+// Lines left without any name are dropped, other names on a line are kept.
+// It returns the number of lines changed or dropped.
+func (s *Syncer) RemoveUnmanaged(domains []string) (int, error) {
+	remove := make(map[string]bool, len(domains))
+	for _, domain := range domains {
+		remove[strings.ToLower(domain)] = true
+	}
+
+	changed := 0
+	err := s.syncWith(func(otherLines []string) []string {
+		result := make([]string, 0, len(otherLines))
+		for _, line := range otherLines {
+			ip, names := parseHostFields(strings.TrimSpace(line))
+			if ip == "" {
+				result = append(result, line)
+				continue
+			}
+
+			kept := make([]string, 0, len(names))
+			for _, name := range names {
+				if !remove[strings.ToLower(name)] {
+					kept = append(kept, name)
+				}
+			}
+			if len(kept) == len(names) {
+				result = append(result, line)
+				continue
+			}
+
+			changed++
+			if len(kept) == 0 {
+				continue
+			}
+
+			rewritten := ip + "\t" + strings.Join(kept, " ")
+			if i := strings.Index(line, "#"); i >= 0 {
+				rewritten += " " + line[i:]
+			}
+			result = append(result, rewritten)
+		}
+		return result
+	})
+
+	return changed, err
+}
+
+// parseHostFields splits a hosts line into its IP and all names, ignoring any
+// trailing comment. It returns an empty IP for comments and malformed lines.
+func parseHostFields(line string) (string, []string) {
+	if i := strings.Index(line, "#"); i >= 0 {
+		line = line[:i]
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return "", nil
+	}
+
+	return fields[0], fields[1:]
+}
@@ -0,0 +1,184 @@
+package audit
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+)
+
+// Actors that can cause a change.
+const (
+	ActorAPI       = "api"       // HTTP API client, e.g. the browser extension
+	ActorOptimizer = "optimizer" // opt reports from cf_opt
+	ActorScheduler = "scheduler" // background loops such as failover and expiry
+	ActorCLI       = "cli"       // one-shot command line operations
+	ActorSystem    = "system"    // host_manager itself, e.g. on startup
+)
+
+// Audited actions.
+const (
+	ActionHostCreate = "host.create"
+	ActionHostUpdate = "host.update"
+	ActionHostDelete = "host.delete"
+	ActionHostImport = "host.import"
+	ActionOptReport  = "opt.report"
+	ActionOptChange  = "opt.change"
+
+	ActionOptQuarantineClear = "opt.quarantine.clear"
+
+	ActionRevisionRollback = "revision.rollback"
+
+	ActionSyncDrift = "sync.drift"
+)
+
+// Cause describes who triggered a change and why.
+type Cause struct {
+	Actor  string `json:"actor"`
+	Client string `json:"client,omitempty"` // remote address of API callers
+	Reason string `json:"reason,omitempty"`
+}
+
+// Or returns the cause with reason filled in when the caller gave none.
+func (c Cause) Or(reason string) Cause {
+	if c.Reason == "" {
+		c.Reason = reason
+	}
+	return c
+}
+
+// Record is a single audit log entry. Before and After hold the JSON state of
+// the target around the change; either is omitted for creations and deletions.
+type Record struct {
+	ID     int64           `json:"id"`
+	Time   time.Time       `json:"time"`
+	Actor  string          `json:"actor"`
+	Client string          `json:"client,omitempty"`
+	Action string          `json:"action"`
+	Target string          `json:"target"` // domain for host actions, type for opt actions
+	Reason string          `json:"reason,omitempty"`
+	Before json.RawMessage `json:"before,omitempty"`
+	After  json.RawMessage `json:"after,omitempty"`
+}
+
+// Query filters audit records. Zero values mean "no filter".
+type Query struct {
+	Actor  string    `form:"actor"`
+	Action string    `form:"action"` // exact action, or a prefix ending in "." such as "host."
+	Target string    `form:"target"`
+	Since  time.Time `form:"since" time_format:"2006-01-02T15:04:05Z07:00"`
+	Until  time.Time `form:"until" time_format:"2006-01-02T15:04:05Z07:00"`
+	Limit  int       `form:"limit"` // default DefaultLimit, capped at MaxLimit
+}
+
+// Query limits.
+const (
+	DefaultLimit = 100
+	MaxLimit     = 1000
+)
+
+// Match reports whether r passes every filter of q.
+func (q Query) Match(r Record) bool {
+	if q.Actor != "" && r.Actor != q.Actor {
+		return false
+	}
+	if q.Action != "" && !matchAction(r.Action, q.Action) {
+		return false
+	}
+	if q.Target != "" && r.Target != q.Target {
+		return false
+	}
+	if !q.Since.IsZero() && r.Time.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && r.Time.After(q.Until) {
+		return false
+	}
+	return true
+}
+
+func matchAction(action, filter string) bool {
+	if filter[len(filter)-1] == '.' {
+		return len(action) >= len(filter) && action[:len(filter)] == filter
+	}
+	return action == filter
+}
+
+// limit returns the effective result limit.
+func (q Query) limit() int {
+	if q.Limit <= 0 {
+		return DefaultLimit
+	}
+	if q.Limit > MaxLimit {
+		return MaxLimit
+	}
+	return q.Limit
+}
+
+// Store persists audit records. Records are append-only.
+type Store interface {
+	// Append stores the record and assigns its ID.
+	Append(r *Record) error
+	// Query returns matching records, newest first.
+	Query(q Query) ([]Record, error)
+}
+
+// Logger records audit events. A nil *Logger discards everything, so services
+// work unchanged when auditing is not configured.
+type Logger struct {
+	store Store
+}
+
+// NewLogger creates a logger writing to store.
+func NewLogger(store Store) *Logger {
+	return &Logger{store: store}
+}
+
+// Record appends an event. Failures are logged but never fail the audited
+// operation.
+func (l *Logger) Record(cause Cause, action, target string, before, after interface{}) {
+	if l == nil {
+		return
+	}
+
+	r := Record{
+		Time:   time.Now(),
+		Actor:  cause.Actor,
+		Client: cause.Client,
+		Action: action,
+		Target: target,
+		Reason: cause.Reason,
+		Before: marshal(before),
+		After:  marshal(after),
+	}
+
+	if err := l.store.Append(&r); err != nil {
+		log.Printf("Warning: failed to write audit record (%s %s): %v", action, target, err)
+	}
+}
+
+// Query returns matching records, newest first.
+func (l *Logger) Query(q Query) ([]Record, error) {
+	if l == nil {
+		return []Record{}, nil
+	}
+	return l.store.Query(q)
+}
+
+func marshal(v interface{}) json.RawMessage {
+	if v == nil {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("Warning: failed to encode audit state: %v", err)
+		return nil
+	}
+	return data
+}
+
+// QueryResponse models the response of GET /audit.
+type QueryResponse struct {
+	Code    int      `json:"code"`
+	Message string   `json:"message"`
+	Data    []Record `json:"data"`
+}
@@ -0,0 +1,93 @@
+package audit
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+
+	"hostMgr/internal/store"
+)
+
+// FileStore keeps audit records as JSON lines appended to a file.
+type FileStore struct {
+	file   *store.JSONLFile
+	mu     sync.Mutex
+	nextID int64
+}
+
+// NewFileStore opens the audit file at path, creating its directory if needed.
+func NewFileStore(path string) (*FileStore, error) {
+	file, err := store.OpenJSONL(path)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &FileStore{file: file, nextID: 1}
+
+	// 续接已有记录的编号
+	skipped, err := s.scan(func(r Record) {
+		if r.ID >= s.nextID {
+			s.nextID = r.ID + 1
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if skipped > 0 {
+		log.Printf("Warning: skipped %d malformed line(s) in audit log %s", skipped, path)
+	}
+
+	return s, nil
+}
+
+// Append writes the record as a new line.
+func (s *FileStore) Append(r *Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r.ID = s.nextID
+	if err := s.file.Append(r); err != nil {
+		return err
+	}
+
+	s.nextID++
+	return nil
+}
+
+// Query scans the file and returns matching records, newest first.
+func (s *FileStore) Query(q Query) ([]Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	matched := make([]Record, 0)
+	_, err := s.scan(func(r Record) {
+		if q.Match(r) {
+			matched = append(matched, r)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// 文件按时间顺序追加，倒序后截取最新的记录
+	limit := q.limit()
+	result := make([]Record, 0, limit)
+	for i := len(matched) - 1; i >= 0 && len(result) < limit; i-- {
+		result = append(result, matched[i])
+	}
+
+	return result, nil
+}
+
+// scan calls fn for every record in the file and returns the number of
+// malformed lines skipped.
+func (s *FileStore) scan(fn func(Record)) (int, error) {
+	return s.file.Scan(func(line []byte) error {
+		var r Record
+		if err := json.Unmarshal(line, &r); err != nil {
+			return err
+		}
+		fn(r)
+		return nil
+	})
+}
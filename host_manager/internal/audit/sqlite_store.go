@@ -0,0 +1,129 @@
+package audit
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// SQLiteStore keeps audit records in the audit_log table.
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+var (
+	_ Store = (*FileStore)(nil)
+	_ Store = (*SQLiteStore)(nil)
+)
+
+// NewSQLiteStore creates the audit_log table if needed.
+func NewSQLiteStore(db *sql.DB) (*SQLiteStore, error) {
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS audit_log (
+		id     INTEGER PRIMARY KEY AUTOINCREMENT,
+		time   INTEGER NOT NULL,
+		actor  TEXT NOT NULL,
+		client TEXT NOT NULL DEFAULT '',
+		action TEXT NOT NULL,
+		target TEXT NOT NULL,
+		reason TEXT NOT NULL DEFAULT '',
+		before TEXT,
+		after  TEXT
+	)`); err != nil {
+		return nil, fmt.Errorf("create audit_log table: %w", err)
+	}
+
+	if _, err := db.Exec(`CREATE INDEX IF NOT EXISTS idx_audit_log_target ON audit_log (target, time)`); err != nil {
+		return nil, fmt.Errorf("create audit_log index: %w", err)
+	}
+
+	return &SQLiteStore{db: db}, nil
+}
+
+// Append inserts the record. Time is stored as Unix nanoseconds.
+func (s *SQLiteStore) Append(r *Record) error {
+	res, err := s.db.Exec(`INSERT INTO audit_log (time, actor, client, action, target, reason, before, after)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		r.Time.UnixNano(), r.Actor, r.Client, r.Action, r.Target, r.Reason, nullJSON(r.Before), nullJSON(r.After))
+	if err != nil {
+		return err
+	}
+
+	r.ID, err = res.LastInsertId()
+	return err
+}
+
+// Query returns matching records, newest first.
+func (s *SQLiteStore) Query(q Query) ([]Record, error) {
+	var (
+		where []string
+		args  []interface{}
+	)
+	if q.Actor != "" {
+		where = append(where, "actor = ?")
+		args = append(args, q.Actor)
+	}
+	if q.Action != "" {
+		if strings.HasSuffix(q.Action, ".") {
+			where = append(where, "substr(action, 1, ?) = ?")
+			args = append(args, len(q.Action), q.Action)
+		} else {
+			where = append(where, "action = ?")
+			args = append(args, q.Action)
+		}
+	}
+	if q.Target != "" {
+		where = append(where, "target = ?")
+		args = append(args, q.Target)
+	}
+	if !q.Since.IsZero() {
+		where = append(where, "time >= ?")
+		args = append(args, q.Since.UnixNano())
+	}
+	if !q.Until.IsZero() {
+		where = append(where, "time <= ?")
+		args = append(args, q.Until.UnixNano())
+	}
+
+	query := `SELECT id, time, actor, client, action, target, reason, before, after FROM audit_log`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, q.limit())
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]Record, 0)
+	for rows.Next() {
+		var (
+			r             Record
+			nanos         int64
+			before, after sql.NullString
+		)
+		if err := rows.Scan(&r.ID, &nanos, &r.Actor, &r.Client, &r.Action, &r.Target, &r.Reason, &before, &after); err != nil {
+			return nil, err
+		}
+		r.Time = time.Unix(0, nanos)
+		if before.Valid {
+			r.Before = []byte(before.String)
+		}
+		if after.Valid {
+			r.After = []byte(after.String)
+		}
+		result = append(result, r)
+	}
+
+	return result, rows.Err()
+}
+
+func nullJSON(raw []byte) sql.NullString {
+	if len(raw) == 0 {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: string(raw), Valid: true}
+}
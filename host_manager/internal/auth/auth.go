@@ -0,0 +1,141 @@
+// Package auth verifies the credentials of requests to mutating endpoints.
+//
+// Two schemes are accepted:
+//
+//   - a static token, sent as "Authorization: Bearer <token>" or in the
+//     X-HostBoost-Token header;
+//   - an HMAC-SHA256 signature, sent in X-HostBoost-Signature together with the
+//     Unix timestamp in X-HostBoost-Timestamp. The signed message is
+//     "<timestamp>\n<METHOD>\n<request URI>\n<body>", hex encoded.
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Credential headers.
+const (
+	TokenHeader     = "X-HostBoost-Token"
+	TimestampHeader = "X-HostBoost-Timestamp"
+	SignatureHeader = "X-HostBoost-Signature"
+)
+
+// MaxSkew is how far a signed request's timestamp may drift from the server clock.
+const MaxSkew = 5 * time.Minute
+
+var (
+	ErrMissingCredentials = errors.New("authentication required")
+	ErrInvalidToken       = errors.New("invalid token")
+	ErrInvalidSignature   = errors.New("invalid signature")
+	ErrExpiredSignature   = errors.New("signature timestamp out of range")
+)
+
+// Authenticator checks requests against the configured token and HMAC secret.
+// Either may be empty, in which case that scheme is rejected.
+type Authenticator struct {
+	token  string
+	secret []byte
+	now    func() time.Time
+}
+
+// New returns an authenticator, or nil when neither a token nor a secret is set.
+func New(token, secret string) *Authenticator {
+	if token == "" && secret == "" {
+		return nil
+	}
+
+	a := &Authenticator{token: token, now: time.Now}
+	if secret != "" {
+		a.secret = []byte(secret)
+	}
+	return a
+}
+
+// Verify checks the credentials of r. body is the raw request body, which is
+// part of the HMAC signature.
+func (a *Authenticator) Verify(r *http.Request, body []byte) error {
+	if signature := r.Header.Get(SignatureHeader); signature != "" {
+		return a.verifySignature(r, body, signature)
+	}
+
+	token := r.Header.Get(TokenHeader)
+	if bearer := r.Header.Get("Authorization"); token == "" && strings.HasPrefix(bearer, "Bearer ") {
+		token = strings.TrimSpace(strings.TrimPrefix(bearer, "Bearer "))
+	}
+	if token == "" {
+		return ErrMissingCredentials
+	}
+	if a.token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) != 1 {
+		return ErrInvalidToken
+	}
+	return nil
+}
+
+func (a *Authenticator) verifySignature(r *http.Request, body []byte, signature string) error {
+	if a.secret == nil {
+		return ErrInvalidSignature
+	}
+
+	timestamp := r.Header.Get(TimestampHeader)
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrExpiredSignature
+	}
+	if skew := a.now().Sub(time.Unix(unix, 0)); skew > MaxSkew || skew < -MaxSkew {
+		return ErrExpiredSignature
+	}
+
+	expected := Sign(a.secret, timestamp, r.Method, r.URL.RequestURI(), body)
+	if !hmac.Equal([]byte(strings.ToLower(signature)), []byte(expected)) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// Sign returns the hex encoded HMAC-SHA256 signature of a request.
+func Sign(secret []byte, timestamp, method, requestURI string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp + "\n" + method + "\n" + requestURI + "\n"))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// LoadOrCreateToken reads the token stored at path, generating and saving a
+// random one (readable by the owner only) the first time. created reports
+// whether a new token was written.
+func LoadOrCreateToken(path string) (token string, created bool, err error) {
+	raw, err := os.ReadFile(path)
+	if err == nil {
+		if token = strings.TrimSpace(string(raw)); token != "" {
+			return token, false, nil
+		}
+	} else if !os.IsNotExist(err) {
+		return "", false, err
+	}
+
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", false, fmt.Errorf("generate token: %w", err)
+	}
+	token = hex.EncodeToString(buf)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", false, err
+	}
+	if err := os.WriteFile(path, []byte(token+"\n"), 0o600); err != nil {
+		return "", false, fmt.Errorf("write token file: %w", err)
+	}
+	return token, true, nil
+}
@@ -0,0 +1,99 @@
+package cdn
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+)
+
+// Detector matches IP addresses against per-type CIDR ranges.
+type Detector struct {
+	ranges map[string][]*net.IPNet
+	types  []string // 排序后的类型列表，保证匹配顺序稳定
+}
+
+// NewDetector builds a detector from a type -> CIDR list mapping.
+func NewDetector(ranges map[string][]string) (*Detector, error) {
+	d := &Detector{
+		ranges: make(map[string][]*net.IPNet, len(ranges)),
+		types:  make([]string, 0, len(ranges)),
+	}
+
+	for cdnType, cidrs := range ranges {
+		cdnType = strings.TrimSpace(strings.ToLower(cdnType))
+		if cdnType == "" {
+			continue
+		}
+
+		nets := make([]*net.IPNet, 0, len(cidrs))
+		for _, cidr := range cidrs {
+			_, ipNet, err := net.ParseCIDR(strings.TrimSpace(cidr))
+			if err != nil {
+				return nil, fmt.Errorf("invalid cidr %q for type %s: %w", cidr, cdnType, err)
+			}
+			nets = append(nets, ipNet)
+		}
+
+		if _, exists := d.ranges[cdnType]; !exists {
+			d.types = append(d.types, cdnType)
+		}
+		d.ranges[cdnType] = append(d.ranges[cdnType], nets...)
+	}
+
+	sort.Strings(d.types)
+
+	return d, nil
+}
+
+// Match returns the CDN type whose ranges contain the given IP.
+func (d *Detector) Match(ip string) (string, bool) {
+	parsed := net.ParseIP(strings.TrimSpace(ip))
+	if parsed == nil {
+		return "", false
+	}
+
+	for _, cdnType := range d.types {
+		for _, ipNet := range d.ranges[cdnType] {
+			if ipNet.Contains(parsed) {
+				return cdnType, true
+			}
+		}
+	}
+
+	return "", false
+}
+
+// Detect returns the CDN type matched by the most IPs in the list.
+// Ties are broken by the order of the first matching IP.
+func (d *Detector) Detect(ips []string) (string, bool) {
+	counts := make(map[string]int)
+	order := make([]string, 0)
+
+	for _, ip := range ips {
+		cdnType, ok := d.Match(ip)
+		if !ok {
+			continue
+		}
+		if counts[cdnType] == 0 {
+			order = append(order, cdnType)
+		}
+		counts[cdnType]++
+	}
+
+	best := ""
+	for _, cdnType := range order {
+		if best == "" || counts[cdnType] > counts[best] {
+			best = cdnType
+		}
+	}
+
+	return best, best != ""
+}
+
+// Types returns all CDN types known to the detector.
+func (d *Detector) Types() []string {
+	result := make([]string, len(d.types))
+	copy(result, d.types)
+	return result
+}
@@ -0,0 +1,89 @@
+package dns
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// MessageContentType is the media type of DNS messages over HTTPS (RFC 8484).
+const MessageContentType = "application/dns-message"
+
+// maxMessageSize is the largest DNS message accepted over HTTPS.
+const maxMessageSize = 65535
+
+var (
+	ErrMissingQuery       = errors.New("missing dns query")
+	ErrUnsupportedContent = errors.New("content type must be " + MessageContentType)
+)
+
+// ReadDoHQuery extracts the DNS query from an RFC 8484 request: the base64url
+// "dns" parameter of a GET, or the body of a POST.
+func ReadDoHQuery(r *http.Request) ([]byte, error) {
+	switch r.Method {
+	case http.MethodGet:
+		param := r.URL.Query().Get("dns")
+		if param == "" {
+			return nil, ErrMissingQuery
+		}
+		query, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(param, "="))
+		if err != nil {
+			return nil, fmt.Errorf("invalid dns parameter: %w", err)
+		}
+		return query, nil
+	case http.MethodPost:
+		if ct := r.Header.Get("Content-Type"); !strings.HasPrefix(ct, MessageContentType) {
+			return nil, ErrUnsupportedContent
+		}
+		query, err := io.ReadAll(io.LimitReader(r.Body, maxMessageSize+1))
+		if err != nil {
+			return nil, err
+		}
+		if len(query) == 0 {
+			return nil, ErrMissingQuery
+		}
+		if len(query) > maxMessageSize {
+			return nil, errors.New("dns message too large")
+		}
+		return query, nil
+	default:
+		return nil, fmt.Errorf("method %s not allowed", r.Method)
+	}
+}
+
+// HandleDoH answers a query received over HTTPS. HTTP has no size limit, so a
+// forwarded answer truncated over UDP is fetched again over TCP.
+func (h *Handler) HandleDoH(ctx context.Context, query []byte) []byte {
+	resp := h.Handle(ctx, "udp", query)
+	if truncated(resp) {
+		return h.Handle(ctx, "tcp", query)
+	}
+	return resp
+}
+
+// truncated reports whether the TC bit of a response is set.
+func truncated(resp []byte) bool {
+	return len(resp) > 2 && resp[2]&0x02 != 0
+}
+
+// MinTTL returns the smallest TTL among the answers of a response, used as
+// the HTTP cache lifetime. ok is false when there are no answers.
+func MinTTL(resp []byte) (ttl uint32, ok bool) {
+	var msg dnsmessage.Message
+	if err := msg.Unpack(resp); err != nil {
+		return 0, false
+	}
+
+	for i, answer := range msg.Answers {
+		if i == 0 || answer.Header.TTL < ttl {
+			ttl = answer.Header.TTL
+		}
+	}
+	return ttl, len(msg.Answers) > 0
+}
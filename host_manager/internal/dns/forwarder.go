@@ -0,0 +1,162 @@
+package dns
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Forwarder resolves the queries the server does not answer itself.
+// network is "udp" or "tcp", matching how the client asked, so a truncated
+// UDP answer makes the client retry over TCP as usual.
+type Forwarder interface {
+	Forward(ctx context.Context, network string, query []byte) ([]byte, error)
+}
+
+// UpstreamForwarder sends queries to a list of upstream servers, trying them
+// in order until one answers.
+type UpstreamForwarder struct {
+	upstreams []string
+	timeout   time.Duration
+	client    *http.Client
+}
+
+// NewUpstreamForwarder creates a forwarder for the given upstreams: either
+// "host:port" plain DNS servers, port 53 being assumed when missing, or
+// "https://" DNS-over-HTTPS URLs (RFC 8484).
+func NewUpstreamForwarder(upstreams []string, timeout time.Duration) *UpstreamForwarder {
+	if timeout <= 0 {
+		timeout = 3 * time.Second
+	}
+
+	addrs := make([]string, 0, len(upstreams))
+	for _, upstream := range upstreams {
+		if !isDoH(upstream) {
+			if _, _, err := net.SplitHostPort(upstream); err != nil {
+				upstream = net.JoinHostPort(upstream, "53")
+			}
+		}
+		addrs = append(addrs, upstream)
+	}
+
+	return &UpstreamForwarder{upstreams: addrs, timeout: timeout, client: &http.Client{}}
+}
+
+func isDoH(upstream string) bool {
+	return strings.HasPrefix(upstream, "https://") || strings.HasPrefix(upstream, "http://")
+}
+
+// Forward returns the first upstream answer to query.
+func (f *UpstreamForwarder) Forward(ctx context.Context, network string, query []byte) ([]byte, error) {
+	if len(f.upstreams) == 0 {
+		return nil, errors.New("no upstream configured")
+	}
+
+	var lastErr error
+	for _, upstream := range f.upstreams {
+		resp, err := f.exchange(ctx, network, upstream, query)
+		if err == nil {
+			return resp, nil
+		}
+		lastErr = fmt.Errorf("upstream %s: %w", upstream, err)
+	}
+	return nil, lastErr
+}
+
+func (f *UpstreamForwarder) exchange(ctx context.Context, network, upstream string, query []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, f.timeout)
+	defer cancel()
+
+	if isDoH(upstream) {
+		return f.exchangeDoH(ctx, upstream, query)
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, network, upstream)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if network == "tcp" {
+		if err := writeTCPMessage(conn, query); err != nil {
+			return nil, err
+		}
+		return readTCPMessage(conn)
+	}
+
+	if _, err := conn.Write(query); err != nil {
+		return nil, err
+	}
+
+	// Skip stray datagrams that do not answer this query
+	buf := make([]byte, 65535)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		if n >= 2 && len(query) >= 2 && buf[0] == query[0] && buf[1] == query[1] {
+			return append([]byte(nil), buf[:n]...), nil
+		}
+	}
+}
+
+// exchangeDoH POSTs the query to a DNS-over-HTTPS upstream.
+func (f *UpstreamForwarder) exchangeDoH(ctx context.Context, url string, query []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(query))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", MessageContentType)
+	req.Header.Set("Accept", MessageContentType)
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 65535))
+}
+
+// readTCPMessage reads one length-prefixed DNS message (RFC 1035 4.2.2).
+func readTCPMessage(r io.Reader) ([]byte, error) {
+	var length uint16
+	if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+		return nil, err
+	}
+
+	msg := make([]byte, length)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// writeTCPMessage writes msg with its two-byte length prefix.
+func writeTCPMessage(w io.Writer, msg []byte) error {
+	if len(msg) > 65535 {
+		return errors.New("dns message too large")
+	}
+
+	buf := make([]byte, 2+len(msg))
+	binary.BigEndian.PutUint16(buf, uint16(len(msg)))
+	copy(buf[2:], msg)
+	_, err := w.Write(buf)
+	return err
+}
@@ -0,0 +1,296 @@
+// Package dns serves the managed hosts over DNS so clients can use
+// host_manager as their resolver instead of relying on the system hosts file.
+// A/AAAA queries for managed domains are answered from the host repository on
+// every request, so opt rotations apply immediately; all other queries are
+// passed to a Forwarder.
+package dns
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// Resolver looks up a managed domain. ips is the host's ordered IP list,
+// primary first; ok is false when the domain is not managed.
+type Resolver interface {
+	LookupManaged(domain string) (ips []string, ok bool)
+}
+
+// SVCB and HTTPS records (RFC 9460) carry address hints that would let clients
+// bypass the managed IPs, so they are answered empty for managed domains.
+const (
+	typeSVCB  dnsmessage.Type = 64
+	typeHTTPS dnsmessage.Type = 65
+)
+
+// tcpIdleTimeout closes TCP connections that stay silent for too long.
+const tcpIdleTimeout = 10 * time.Second
+
+// Handler answers raw DNS queries: managed domains from the Resolver, the rest
+// through the Forwarder. It is shared by the UDP/TCP server and DoH endpoint.
+type Handler struct {
+	resolver  Resolver
+	forwarder Forwarder
+	ttl       uint32
+}
+
+// NewHandler creates a handler. Answers for managed domains carry the given
+// TTL in seconds; without a forwarder other queries are refused.
+func NewHandler(resolver Resolver, forwarder Forwarder, ttl uint32) *Handler {
+	return &Handler{
+		resolver:  resolver,
+		forwarder: forwarder,
+		ttl:       ttl,
+	}
+}
+
+// Server is a UDP and TCP DNS server answering through a Handler.
+type Server struct {
+	addr    string
+	handler *Handler
+
+	mu       sync.Mutex
+	udp      net.PacketConn
+	tcp      net.Listener
+	wg       sync.WaitGroup
+	stopping bool
+}
+
+// NewServer creates a server listening on addr.
+func NewServer(addr string, handler *Handler) *Server {
+	return &Server{
+		addr:    addr,
+		handler: handler,
+	}
+}
+
+// Start listens on UDP and TCP and serves in background goroutines.
+func (s *Server) Start() error {
+	udp, err := net.ListenPacket("udp", s.addr)
+	if err != nil {
+		return err
+	}
+	tcp, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		udp.Close()
+		return err
+	}
+
+	s.mu.Lock()
+	s.udp, s.tcp = udp, tcp
+	s.mu.Unlock()
+
+	s.wg.Add(2)
+	go s.serveUDP(udp)
+	go s.serveTCP(tcp)
+	return nil
+}
+
+// Stop closes the listeners and waits for the serve loops to exit.
+func (s *Server) Stop() {
+	s.mu.Lock()
+	if s.stopping || s.udp == nil {
+		s.mu.Unlock()
+		return
+	}
+	s.stopping = true
+	s.udp.Close()
+	s.tcp.Close()
+	s.mu.Unlock()
+
+	s.wg.Wait()
+}
+
+// UDPAddr returns the bound UDP address, useful when listening on port 0.
+func (s *Server) UDPAddr() net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.udp == nil {
+		return nil
+	}
+	return s.udp.LocalAddr()
+}
+
+// TCPAddr returns the bound TCP address, useful when listening on port 0.
+func (s *Server) TCPAddr() net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.tcp == nil {
+		return nil
+	}
+	return s.tcp.Addr()
+}
+
+func (s *Server) serveUDP(conn net.PacketConn) {
+	defer s.wg.Done()
+
+	buf := make([]byte, 65535)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			log.Printf("Warning: dns udp read: %v", err)
+			continue
+		}
+
+		query := append([]byte(nil), buf[:n]...)
+		go func() {
+			resp := s.handler.Handle(context.Background(), "udp", query)
+			if resp == nil {
+				return
+			}
+			if _, err := conn.WriteTo(resp, addr); err != nil && !errors.Is(err, net.ErrClosed) {
+				log.Printf("Warning: dns udp write to %s: %v", addr, err)
+			}
+		}()
+	}
+}
+
+func (s *Server) serveTCP(ln net.Listener) {
+	defer s.wg.Done()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			log.Printf("Warning: dns tcp accept: %v", err)
+			continue
+		}
+		go s.serveTCPConn(conn)
+	}
+}
+
+func (s *Server) serveTCPConn(conn net.Conn) {
+	defer conn.Close()
+
+	for {
+		conn.SetReadDeadline(time.Now().Add(tcpIdleTimeout))
+		query, err := readTCPMessage(conn)
+		if err != nil {
+			return
+		}
+
+		resp := s.handler.Handle(context.Background(), "tcp", query)
+		if resp == nil {
+			return
+		}
+		if err := writeTCPMessage(conn, resp); err != nil {
+			return
+		}
+	}
+}
+
+// Handle returns the response to a raw DNS query received over network
+// ("udp" or "tcp"), or nil when the query is too malformed to answer.
+func (h *Handler) Handle(ctx context.Context, network string, query []byte) []byte {
+	var p dnsmessage.Parser
+	header, err := p.Start(query)
+	if err != nil {
+		return nil
+	}
+	if header.Response {
+		return nil
+	}
+
+	if header.OpCode != 0 {
+		return h.reply(header, nil, dnsmessage.RCodeNotImplemented, nil)
+	}
+
+	question, err := p.Question()
+	if err != nil {
+		return h.reply(header, nil, dnsmessage.RCodeFormatError, nil)
+	}
+
+	if answers, ok := h.answer(question); ok {
+		return h.reply(header, &question, dnsmessage.RCodeSuccess, answers)
+	}
+
+	if h.forwarder == nil {
+		return h.reply(header, &question, dnsmessage.RCodeRefused, nil)
+	}
+	resp, err := h.forwarder.Forward(ctx, network, query)
+	if err != nil {
+		log.Printf("Warning: dns forward %s %s: %v", question.Type, question.Name, err)
+		return h.reply(header, &question, dnsmessage.RCodeServerFailure, nil)
+	}
+	return resp
+}
+
+// answer returns the records for a question about a managed domain. ok is
+// false when the question should be forwarded instead. A managed domain
+// without an IP of the asked family gets an empty answer, so clients never
+// fall back to the upstream address.
+func (h *Handler) answer(q dnsmessage.Question) ([]dnsmessage.Resource, bool) {
+	if q.Class != dnsmessage.ClassINET {
+		return nil, false
+	}
+	switch q.Type {
+	case dnsmessage.TypeA, dnsmessage.TypeAAAA, typeSVCB, typeHTTPS:
+	default:
+		return nil, false
+	}
+
+	domain := strings.TrimSuffix(strings.ToLower(q.Name.String()), ".")
+	ips, ok := h.resolver.LookupManaged(domain)
+	if !ok {
+		return nil, false
+	}
+
+	header := dnsmessage.ResourceHeader{Name: q.Name, Type: q.Type, Class: dnsmessage.ClassINET, TTL: h.ttl}
+	for _, raw := range ips {
+		ip := net.ParseIP(raw)
+		if ip == nil {
+			continue
+		}
+
+		// Answer with the first IP of the asked family, normally the primary
+		if ip4 := ip.To4(); ip4 != nil && q.Type == dnsmessage.TypeA {
+			var a dnsmessage.AResource
+			copy(a.A[:], ip4)
+			return []dnsmessage.Resource{{Header: header, Body: &a}}, true
+		}
+		if ip.To4() == nil && q.Type == dnsmessage.TypeAAAA {
+			var aaaa dnsmessage.AAAAResource
+			copy(aaaa.AAAA[:], ip.To16())
+			return []dnsmessage.Resource{{Header: header, Body: &aaaa}}, true
+		}
+	}
+	return nil, true
+}
+
+// reply builds a response to the query header with the given question and answers.
+func (h *Handler) reply(query dnsmessage.Header, question *dnsmessage.Question, rcode dnsmessage.RCode, answers []dnsmessage.Resource) []byte {
+	msg := dnsmessage.Message{
+		Header: dnsmessage.Header{
+			ID:                 query.ID,
+			Response:           true,
+			OpCode:             query.OpCode,
+			Authoritative:      rcode == dnsmessage.RCodeSuccess,
+			RecursionDesired:   query.RecursionDesired,
+			RecursionAvailable: h.forwarder != nil,
+			RCode:              rcode,
+		},
+		Answers: answers,
+	}
+	if question != nil {
+		msg.Questions = []dnsmessage.Question{*question}
+	}
+
+	resp, err := msg.Pack()
+	if err != nil {
+		log.Printf("Warning: dns pack response: %v", err)
+		return nil
+	}
+	return resp
+}
@@ -0,0 +1,211 @@
+package dns
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+type staticResolver map[string][]string
+
+func (r staticResolver) LookupManaged(domain string) ([]string, bool) {
+	ips, ok := r[domain]
+	return ips, ok
+}
+
+// startStubUpstream answers every A query with 9.9.9.9 and returns its address.
+func startStubUpstream(t *testing.T) string {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen stub upstream: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, 65535)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+
+			var query dnsmessage.Message
+			if err := query.Unpack(buf[:n]); err != nil || len(query.Questions) == 0 {
+				continue
+			}
+			q := query.Questions[0]
+			resp := dnsmessage.Message{
+				Header:    dnsmessage.Header{ID: query.ID, Response: true, RecursionAvailable: true},
+				Questions: []dnsmessage.Question{q},
+			}
+			if q.Type == dnsmessage.TypeA {
+				resp.Answers = []dnsmessage.Resource{{
+					Header: dnsmessage.ResourceHeader{Name: q.Name, Type: q.Type, Class: q.Class, TTL: 60},
+					Body:   &dnsmessage.AResource{A: [4]byte{9, 9, 9, 9}},
+				}}
+			}
+			packed, err := resp.Pack()
+			if err != nil {
+				continue
+			}
+			conn.WriteTo(packed, addr)
+		}
+	}()
+
+	return conn.LocalAddr().String()
+}
+
+func startServer(t *testing.T, forwarder Forwarder) *Server {
+	t.Helper()
+
+	resolver := staticResolver{
+		"managed.example.com": {"1.2.3.4", "1.2.3.5"},
+		"dual.example.com":    {"1.2.3.4", "2001:db8::1"},
+	}
+	srv := NewServer("127.0.0.1:0", NewHandler(resolver, forwarder, 30))
+	if err := srv.Start(); err != nil {
+		t.Fatalf("start server: %v", err)
+	}
+	t.Cleanup(srv.Stop)
+	return srv
+}
+
+func exchange(t *testing.T, network string, addr net.Addr, name string, qtype dnsmessage.Type) dnsmessage.Message {
+	t.Helper()
+
+	query := dnsmessage.Message{
+		Header: dnsmessage.Header{ID: 42, RecursionDesired: true},
+		Questions: []dnsmessage.Question{{
+			Name:  dnsmessage.MustNewName(name),
+			Type:  qtype,
+			Class: dnsmessage.ClassINET,
+		}},
+	}
+	packed, err := query.Pack()
+	if err != nil {
+		t.Fatalf("pack query: %v", err)
+	}
+
+	conn, err := net.Dial(network, addr.String())
+	if err != nil {
+		t.Fatalf("dial %s: %v", network, err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	var raw []byte
+	if network == "tcp" {
+		if err := writeTCPMessage(conn, packed); err != nil {
+			t.Fatalf("write query: %v", err)
+		}
+		if raw, err = readTCPMessage(conn); err != nil {
+			t.Fatalf("read response: %v", err)
+		}
+	} else {
+		if _, err := conn.Write(packed); err != nil {
+			t.Fatalf("write query: %v", err)
+		}
+		buf := make([]byte, 65535)
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatalf("read response: %v", err)
+		}
+		raw = buf[:n]
+	}
+
+	var resp dnsmessage.Message
+	if err := resp.Unpack(raw); err != nil {
+		t.Fatalf("unpack response: %v", err)
+	}
+	if resp.ID != query.ID {
+		t.Fatalf("response id = %d, want %d", resp.ID, query.ID)
+	}
+	return resp
+}
+
+func answerA(t *testing.T, resp dnsmessage.Message) net.IP {
+	t.Helper()
+
+	if len(resp.Answers) != 1 {
+		t.Fatalf("got %d answers, want 1", len(resp.Answers))
+	}
+	a, ok := resp.Answers[0].Body.(*dnsmessage.AResource)
+	if !ok {
+		t.Fatalf("answer is %T, want A", resp.Answers[0].Body)
+	}
+	return net.IP(a.A[:])
+}
+
+func TestServerAnswersManagedA(t *testing.T) {
+	srv := startServer(t, NewUpstreamForwarder([]string{startStubUpstream(t)}, time.Second))
+
+	for _, network := range []string{"udp", "tcp"} {
+		addr := srv.UDPAddr()
+		if network == "tcp" {
+			addr = srv.TCPAddr()
+		}
+
+		resp := exchange(t, network, addr, "managed.example.com.", dnsmessage.TypeA)
+		if resp.RCode != dnsmessage.RCodeSuccess || !resp.Authoritative {
+			t.Fatalf("%s: rcode = %v, authoritative = %v", network, resp.RCode, resp.Authoritative)
+		}
+		if ip := answerA(t, resp); !ip.Equal(net.ParseIP("1.2.3.4")) {
+			t.Fatalf("%s: answer = %s, want the primary 1.2.3.4", network, ip)
+		}
+		if ttl := resp.Answers[0].Header.TTL; ttl != 30 {
+			t.Fatalf("%s: ttl = %d, want 30", network, ttl)
+		}
+	}
+}
+
+func TestServerAnswersEmptyAAAAForIPv4OnlyHost(t *testing.T) {
+	srv := startServer(t, NewUpstreamForwarder([]string{startStubUpstream(t)}, time.Second))
+
+	resp := exchange(t, "udp", srv.UDPAddr(), "managed.example.com.", dnsmessage.TypeAAAA)
+	if resp.RCode != dnsmessage.RCodeSuccess {
+		t.Fatalf("rcode = %v, want success", resp.RCode)
+	}
+	if len(resp.Answers) != 0 {
+		t.Fatalf("got %d answers, want none", len(resp.Answers))
+	}
+
+	resp = exchange(t, "udp", srv.UDPAddr(), "dual.example.com.", dnsmessage.TypeAAAA)
+	if len(resp.Answers) != 1 {
+		t.Fatalf("dual-stack host: got %d answers, want 1", len(resp.Answers))
+	}
+	aaaa, ok := resp.Answers[0].Body.(*dnsmessage.AAAAResource)
+	if !ok || !net.IP(aaaa.AAAA[:]).Equal(net.ParseIP("2001:db8::1")) {
+		t.Fatalf("dual-stack host: answer = %v, want 2001:db8::1", resp.Answers[0].Body)
+	}
+}
+
+func TestServerForwardsUnmanagedNames(t *testing.T) {
+	srv := startServer(t, NewUpstreamForwarder([]string{startStubUpstream(t)}, time.Second))
+
+	resp := exchange(t, "udp", srv.UDPAddr(), "other.example.org.", dnsmessage.TypeA)
+	if resp.RCode != dnsmessage.RCodeSuccess {
+		t.Fatalf("rcode = %v, want success", resp.RCode)
+	}
+	if ip := answerA(t, resp); !ip.Equal(net.ParseIP("9.9.9.9")) {
+		t.Fatalf("answer = %s, want the upstream 9.9.9.9", ip)
+	}
+}
+
+func TestServerRefusesWithoutForwarder(t *testing.T) {
+	srv := startServer(t, nil)
+
+	resp := exchange(t, "udp", srv.UDPAddr(), "other.example.org.", dnsmessage.TypeA)
+	if resp.RCode != dnsmessage.RCodeRefused {
+		t.Fatalf("rcode = %v, want refused", resp.RCode)
+	}
+
+	// Managed names are still answered
+	resp = exchange(t, "udp", srv.UDPAddr(), "managed.example.com.", dnsmessage.TypeA)
+	if ip := answerA(t, resp); !ip.Equal(net.ParseIP("1.2.3.4")) {
+		t.Fatalf("answer = %s, want 1.2.3.4", ip)
+	}
+}
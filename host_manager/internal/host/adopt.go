@@ -0,0 +1,126 @@
+package host
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+
+	"hostMgr/internal/audit"
+)
+
+// ListAdoptable returns the domains outside the managed section of the system
+// hosts file whose IPs fall in a known CDN range. Domains already managed by
+// HostBoost are left out.
+func (s *Service) ListAdoptable() ([]AdoptableHost, error) {
+	if s.detector == nil {
+		return nil, errors.New("cdn detector not configured")
+	}
+
+	entries, err := s.syncer.ListUnmanaged()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read system hosts file: %w", err)
+	}
+
+	hosts, err := s.repo.List()
+	if err != nil {
+		return nil, err
+	}
+
+	managed := make(map[string]bool)
+	for _, h := range hosts {
+		for _, d := range h.Domains() {
+			managed[d] = true
+		}
+	}
+
+	byDomain := make(map[string]*AdoptableHost)
+	for _, entry := range entries {
+		cdnType, ok := s.detector.Match(entry.IP)
+		if !ok {
+			continue
+		}
+
+		for _, name := range entry.Domains {
+			domain := normalizeDomain(name)
+			if managed[domain] {
+				continue
+			}
+
+			candidate, exists := byDomain[domain]
+			if !exists {
+				candidate = &AdoptableHost{Domain: domain, Type: cdnType}
+				byDomain[domain] = candidate
+			}
+			if !containsString(candidate.IPs, entry.IP) {
+				candidate.IPs = append(candidate.IPs, entry.IP)
+			}
+			candidate.Lines = append(candidate.Lines, entry.Line)
+		}
+	}
+
+	result := make([]AdoptableHost, 0, len(byDomain))
+	for _, candidate := range byDomain {
+		result = append(result, *candidate)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Domain < result[j].Domain
+	})
+
+	return result, nil
+}
+
+// AdoptHosts moves the selected unmanaged domains under HostBoost management.
+// Each one is re-created under the CDN type matched from its IPs, so it follows
+// the optimizer from now on, and its old lines are removed from the unmanaged
+// part of the system hosts file. Domains that are not adoptable are reported.
+func (s *Service) AdoptHosts(domains []string, cause audit.Cause) (AdoptResult, error) {
+	cause = cause.Or("adopted from system hosts file")
+	if len(domains) == 0 {
+		return AdoptResult{}, errors.New("domains is required")
+	}
+
+	candidates, err := s.ListAdoptable()
+	if err != nil {
+		return AdoptResult{}, err
+	}
+	byDomain := make(map[string]AdoptableHost, len(candidates))
+	for _, candidate := range candidates {
+		byDomain[candidate.Domain] = candidate
+	}
+
+	result := AdoptResult{Adopted: []Host{}, Errors: []AdoptError{}}
+	adopted := make([]string, 0, len(domains))
+	for _, domain := range domains {
+		domain = normalizeDomain(domain)
+		candidate, ok := byDomain[domain]
+		if !ok {
+			result.Errors = append(result.Errors, AdoptError{Domain: domain, Reason: "not an unmanaged entry in a known CDN range"})
+			continue
+		}
+
+		created, err := s.createHost(AddHostRequest{Domain: domain, Type: candidate.Type}, cause)
+		if err != nil {
+			result.Errors = append(result.Errors, AdoptError{Domain: domain, Reason: err.Error()})
+			continue
+		}
+
+		result.Adopted = append(result.Adopted, created)
+		adopted = append(adopted, domain)
+	}
+
+	if len(adopted) == 0 {
+		return result, nil
+	}
+	s.revisions.Capture(cause)
+
+	// 从非管理区域移除已接管的域名，并在同一次写入中同步管理区域
+	changed, err := s.syncer.RemoveUnmanaged(adopted)
+	if err != nil {
+		log.Printf("Warning: failed to remove adopted entries from system hosts: %v", err)
+		return result, err
+	}
+	log.Printf("Adopted %d host(s), %d unmanaged line(s) rewritten", len(adopted), changed)
+
+	return result, nil
+}
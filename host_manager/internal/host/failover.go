@@ -0,0 +1,146 @@
+package host
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"hostMgr/internal/audit"
+	"log"
+	"net"
+	"slices"
+	"sync"
+	"time"
+)
+
+// FailoverChecker periodically probes the primary IP of every host and promotes
+// the next healthy fallback when the primary stops answering TLS for the domain.
+type FailoverChecker struct {
+	svc      *Service
+	interval time.Duration
+	timeout  time.Duration
+	stop     chan struct{}
+	once     sync.Once
+}
+
+// NewFailoverChecker creates a checker bound to the given host service.
+func NewFailoverChecker(svc *Service, interval, timeout time.Duration) *FailoverChecker {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+
+	return &FailoverChecker{
+		svc:      svc,
+		interval: interval,
+		timeout:  timeout,
+		stop:     make(chan struct{}),
+	}
+}
+
+// Start runs the check loop in a background goroutine.
+func (c *FailoverChecker) Start() {
+	go func() {
+		ticker := time.NewTicker(c.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				c.CheckOnce()
+			case <-c.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop terminates the check loop.
+func (c *FailoverChecker) Stop() {
+	c.once.Do(func() {
+		close(c.stop)
+	})
+}
+
+// CheckOnce probes all hosts once and returns the number of hosts whose primary
+// IP was replaced. The system hosts file is synced once if anything changed.
+func (c *FailoverChecker) CheckOnce() int {
+	hosts, err := c.svc.repo.List()
+	if err != nil {
+		log.Printf("Warning: failover check skipped: %v", err)
+		return 0
+	}
+
+	promoted := 0
+	for _, h := range hosts {
+		if !h.Enabled || h.Pinned || len(h.IPs) < 2 || len(h.Domains()) == 0 {
+			continue
+		}
+
+		// 模式条目使用第一个展开后的域名作为 SNI
+		sni := h.Domains()[0]
+
+		err := probeTLS(h.IPs[0], sni, c.timeout)
+		if err == nil {
+			continue
+		}
+		log.Printf("Failover: primary %s of %s is unhealthy: %v", h.IPs[0], h.Domain, err)
+
+		// 依次探测备用 IP，找到第一个可用的并轮换到首位
+		for i := 1; i < len(h.IPs); i++ {
+			if err := probeTLS(h.IPs[i], sni, c.timeout); err != nil {
+				continue
+			}
+
+			// 探测期间 host 可能已被上报、固定或编辑, 只有 IP 列表未变时才轮换
+			probed := h.IPs
+			cause := audit.Cause{
+				Actor:  audit.ActorScheduler,
+				Reason: fmt.Sprintf("failover: primary %s failed TLS probe: %v", probed[0], err),
+			}
+			_, err := c.svc.update(h.Domain, cause, func(stored *Host) error {
+				if stored.Pinned || !stored.Enabled || !slices.Equal(stored.IPs, probed) {
+					return errSkipUpdate
+				}
+				stored.IPs = append(append([]string{}, stored.IPs[i:]...), stored.IPs[:i]...)
+				return nil
+			})
+			if errors.Is(err, errSkipUpdate) {
+				log.Printf("Failover: %s changed while probing, promotion skipped", h.Domain)
+				break
+			}
+			if err != nil {
+				log.Printf("Warning: failed to promote %s for %s: %v", probed[i], h.Domain, err)
+				break
+			}
+
+			log.Printf("Failover: promoted %s to primary for %s", probed[i], h.Domain)
+			promoted++
+			break
+		}
+	}
+
+	if promoted > 0 {
+		c.svc.revisions.Capture(audit.Cause{Actor: audit.ActorScheduler, Reason: fmt.Sprintf("failover promoted %d host(s)", promoted)})
+
+		if err := c.svc.syncer.Sync(); err != nil {
+			log.Printf("Warning: failed to sync hosts to system: %v", err)
+		}
+	}
+
+	return promoted
+}
+
+// probeTLS performs a TLS handshake against ip:443 using domain as SNI and
+// verifies that the presented certificate is valid for the domain.
+func probeTLS(ip, domain string, timeout time.Duration) error {
+	dialer := &net.Dialer{Timeout: timeout}
+	conn, err := tls.DialWithDialer(dialer, "tcp", net.JoinHostPort(ip, "443"), &tls.Config{
+		ServerName: domain,
+	})
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
@@ -0,0 +1,263 @@
+package host
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"hostMgr/internal/audit"
+	"hostMgr/internal/opt"
+)
+
+// HealthOptions configures the opt health monitor.
+type HealthOptions struct {
+	Interval   time.Duration // time between two probes of a type
+	Timeout    time.Duration // timeout of each probe step
+	MaxLatency time.Duration // a probe slower than this counts as a failure, 0 disables
+	Failures   int           // consecutive failed probes that trigger a change
+	HTTPPath   string        // optional path requested over HTTPS after the handshake, e.g. "/cdn-cgi/trace"
+}
+
+// HealthMonitor periodically probes the current opt IP of every type with a TCP
+// connect, a TLS handshake using the SNI of a managed domain of that type and
+// optionally an HTTP request. After Failures consecutive failed or slow probes
+// it switches the type to its next opt IP through opt.Service.ChangeOpt.
+type HealthMonitor struct {
+	svc    *Service
+	optSvc *opt.Service
+	opts   HealthOptions
+	stop   chan struct{}
+	once   sync.Once
+
+	mu      sync.Mutex
+	reports map[string]*HealthReport // latest probe result per type
+}
+
+// HealthReport is the latest probe result of a type.
+type HealthReport struct {
+	Type      string    `json:"type"`
+	IP        string    `json:"ip"`
+	SNI       string    `json:"sni"`
+	CheckedAt time.Time `json:"checked_at"`
+	// Latencies of each probe step in milliseconds, omitted when the step did not run.
+	TCP   *float64 `json:"tcp_ms,omitempty"`
+	TLS   *float64 `json:"tls_ms,omitempty"`
+	HTTP  *float64 `json:"http_ms,omitempty"`
+	Error string   `json:"error,omitempty"`
+	// Failures counts consecutive failed probes of the current IP.
+	Failures int `json:"failures"`
+}
+
+// NewHealthMonitor creates a monitor bound to the host and opt services.
+func NewHealthMonitor(svc *Service, optSvc *opt.Service, opts HealthOptions) *HealthMonitor {
+	if opts.Interval <= 0 {
+		opts.Interval = time.Minute
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 5 * time.Second
+	}
+	if opts.Failures <= 0 {
+		opts.Failures = 3
+	}
+
+	return &HealthMonitor{
+		svc:     svc,
+		optSvc:  optSvc,
+		opts:    opts,
+		stop:    make(chan struct{}),
+		reports: make(map[string]*HealthReport),
+	}
+}
+
+// Start runs the probe loop in a background goroutine.
+func (m *HealthMonitor) Start() {
+	go func() {
+		ticker := time.NewTicker(m.opts.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				m.CheckOnce()
+			case <-m.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop terminates the probe loop.
+func (m *HealthMonitor) Stop() {
+	m.once.Do(func() {
+		close(m.stop)
+	})
+}
+
+// CheckOnce probes the current IP of every type that has managed hosts and
+// returns the number of types switched to another IP.
+func (m *HealthMonitor) CheckOnce() int {
+	changed := 0
+	for _, optType := range m.optSvc.GetAllTypes() {
+		if m.checkType(optType) {
+			changed++
+		}
+	}
+	return changed
+}
+
+func (m *HealthMonitor) checkType(optType string) bool {
+	_, current, err := m.optSvc.GetCurrentOpt(optType)
+	if err != nil {
+		return false
+	}
+
+	sni, ok := m.sniFor(optType, current.IP)
+	if !ok {
+		// 没有使用该类型的 host，探测结果不影响任何域名
+		return false
+	}
+
+	report := m.probe(current.IP, sni)
+	report.Type = optType
+
+	m.mu.Lock()
+	prev := m.reports[optType]
+	if report.Error != "" {
+		report.Failures = 1
+		if prev != nil && prev.IP == current.IP {
+			report.Failures = prev.Failures + 1
+		}
+	}
+	m.reports[optType] = &report
+	m.mu.Unlock()
+
+	if report.Error == "" {
+		return false
+	}
+	log.Printf("Health: %s opt %s (sni %s) failed probe %d/%d: %s", optType, current.IP, sni, report.Failures, m.opts.Failures, report.Error)
+	if report.Failures < m.opts.Failures {
+		return false
+	}
+
+	cause := audit.Cause{
+		Actor:  audit.ActorScheduler,
+		Reason: fmt.Sprintf("health check: %s failed %d consecutive probes: %s", current.IP, report.Failures, report.Error),
+	}
+	if err := m.optSvc.ChangeOpt(optType, cause); err != nil {
+		log.Printf("Warning: health check could not change opt for %s: %v", optType, err)
+		return false
+	}
+
+	_, next, _ := m.optSvc.GetCurrentOpt(optType)
+	log.Printf("Health: switched %s from %s to %s (%s)", optType, current.IP, next.IP, cause.Reason)
+	return true
+}
+
+// sniFor picks the domain used as SNI when probing ip: an enabled, unpinned
+// host of the type currently resolving to ip, otherwise any such host.
+func (m *HealthMonitor) sniFor(optType, ip string) (string, bool) {
+	hosts, err := m.svc.repo.ListByType(optType)
+	if err != nil {
+		log.Printf("Warning: health check skipped for %s: %v", optType, err)
+		return "", false
+	}
+
+	fallback := ""
+	for _, h := range hosts {
+		if !h.Enabled || h.Pinned || len(h.Domains()) == 0 {
+			continue
+		}
+		if h.IP == ip {
+			return h.Domains()[0], true
+		}
+		if fallback == "" {
+			fallback = h.Domains()[0]
+		}
+	}
+	return fallback, fallback != ""
+}
+
+// probe runs the TCP, TLS and optional HTTP steps against ip and records the
+// latency of each. The first failing step, or a step slower than MaxLatency,
+// sets Error.
+func (m *HealthMonitor) probe(ip, sni string) HealthReport {
+	report := HealthReport{IP: ip, SNI: sni, CheckedAt: time.Now()}
+	addr := net.JoinHostPort(ip, "443")
+
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", addr, m.opts.Timeout)
+	if err != nil {
+		report.Error = fmt.Sprintf("tcp connect: %v", err)
+		return report
+	}
+	report.TCP = m.observe(&report, "tcp connect", time.Since(start))
+
+	tlsConn := tls.Client(conn, &tls.Config{ServerName: sni})
+	ctx, cancel := context.WithTimeout(context.Background(), m.opts.Timeout)
+	start = time.Now()
+	err = tlsConn.HandshakeContext(ctx)
+	cancel()
+	tlsConn.Close()
+	if err != nil {
+		report.Error = fmt.Sprintf("tls handshake: %v", err)
+		return report
+	}
+	report.TLS = m.observe(&report, "tls handshake", time.Since(start))
+
+	if m.opts.HTTPPath == "" {
+		return report
+	}
+
+	start = time.Now()
+	if err := probeHTTP(ip, sni, m.opts.HTTPPath, m.opts.Timeout); err != nil {
+		report.Error = fmt.Sprintf("http: %v", err)
+		return report
+	}
+	report.HTTP = m.observe(&report, "http", time.Since(start))
+
+	return report
+}
+
+// observe records a step latency in milliseconds and flags it when slow.
+func (m *HealthMonitor) observe(report *HealthReport, step string, d time.Duration) *float64 {
+	if m.opts.MaxLatency > 0 && d > m.opts.MaxLatency && report.Error == "" {
+		report.Error = fmt.Sprintf("%s took %s (max %s)", step, d.Round(time.Millisecond), m.opts.MaxLatency)
+	}
+	ms := float64(d.Microseconds()) / 1000
+	return &ms
+}
+
+// probeHTTP requests https://sni/path from ip and expects a non-5xx answer.
+func probeHTTP(ip, sni, path string, timeout time.Duration) error {
+	dialer := &net.Dialer{Timeout: timeout}
+	client := &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				return dialer.DialContext(ctx, network, net.JoinHostPort(ip, "443"))
+			},
+			TLSClientConfig:   &tls.Config{ServerName: sni},
+			DisableKeepAlives: true,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	resp, err := client.Get("https://" + sni + path)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 500 {
+		return errors.New(resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package host
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// indexedRepository wraps a Repository with an index of the enabled hosts by
+// every concrete domain they cover, so DNS lookups do not list the whole
+// repository per query. Writes through the wrapper invalidate the index,
+// which is rebuilt on the next lookup.
+type indexedRepository struct {
+	Repository
+
+	mu         sync.Mutex
+	index      map[string][]Host // nil when stale
+	generation uint64            // incremented by every write
+}
+
+func newIndexedRepository(repo Repository) *indexedRepository {
+	return &indexedRepository{Repository: repo}
+}
+
+// lookup returns the IPs of the enabled, unexpired host covering domain.
+func (r *indexedRepository) lookup(domain string, now time.Time) ([]string, bool) {
+	r.mu.Lock()
+	index, generation := r.index, r.generation
+	r.mu.Unlock()
+
+	if index == nil {
+		hosts, err := r.Repository.List()
+		if err != nil {
+			log.Printf("Warning: failed to look up %s: %v", domain, err)
+			return nil, false
+		}
+
+		index = make(map[string][]Host, len(hosts))
+		for _, h := range hosts {
+			if !h.Enabled {
+				continue
+			}
+			for _, d := range h.Domains() {
+				index[d] = append(index[d], h)
+			}
+		}
+
+		// 构建期间有写入时不保存，避免用旧数据覆盖失效标记
+		r.mu.Lock()
+		if r.generation == generation {
+			r.index = index
+		}
+		r.mu.Unlock()
+	}
+
+	for _, h := range index[domain] {
+		if !h.Expired(now) {
+			return append([]string(nil), h.IPs...), true
+		}
+	}
+	return nil, false
+}
+
+func (r *indexedRepository) invalidate() {
+	r.mu.Lock()
+	r.index = nil
+	r.generation++
+	r.mu.Unlock()
+}
+
+func (r *indexedRepository) Create(host Host) error {
+	defer r.invalidate()
+	return r.Repository.Create(host)
+}
+
+func (r *indexedRepository) Delete(domain string) error {
+	defer r.invalidate()
+	return r.Repository.Delete(domain)
+}
+
+func (r *indexedRepository) Update(domain string, mutate func(*Host) error) (Host, error) {
+	defer r.invalidate()
+	return r.Repository.Update(domain, mutate)
+}
+
+func (r *indexedRepository) Import(hosts []Host, replace bool) error {
+	defer r.invalidate()
+	return r.Repository.Import(hosts, replace)
+}
+
+func (r *indexedRepository) DeleteExpired(now time.Time) ([]Host, error) {
+	defer r.invalidate()
+	return r.Repository.DeleteExpired(now)
+}
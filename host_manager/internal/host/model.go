@@ -1,10 +1,72 @@
 package host
 
+import (
+	"encoding/json"
+	"time"
+
+	"hostMgr/hostsync"
+)
+
 // Host represents a single host entry stored in the simulated hosts file.
 type Host struct {
-	Domain string `json:"domain"`
-	IP     string `json:"ip"`
-	Type   string `json:"type"`
+	Domain string   `json:"domain"`
+	IP     string   `json:"ip"`  // primary IP, always equal to IPs[0]
+	IPs    []string `json:"ips"` // ordered IP list: primary followed by fallbacks
+	Type   string   `json:"type"`
+	// Subdomains lists the labels a pattern entry ("*.example.com") expands to,
+	// "@" standing for the base domain itself. Empty for plain hosts.
+	Subdomains []string `json:"subdomains,omitempty"`
+	// Pinned hosts keep their hand-picked IPs and are skipped by opt rotation.
+	Pinned bool `json:"pinned"`
+	// Enabled controls whether the host is written to the system hosts file.
+	// Disabled hosts stay in hosts.json so they can be switched back on.
+	Enabled bool `json:"enabled"`
+	// ExpiresAt is set for time-limited hosts, which the reaper removes once expired.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// Notes is free-form text kept alongside the host.
+	Notes string `json:"notes,omitempty"`
+}
+
+// UnmarshalJSON defaults Enabled to true so entries written before the flag
+// existed stay active.
+func (h *Host) UnmarshalJSON(data []byte) error {
+	type plain Host
+	decoded := plain{Enabled: true}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	*h = Host(decoded)
+	return nil
+}
+
+// Domains returns the concrete domains covered by the host.
+func (h Host) Domains() []string {
+	return hostsync.ExpandDomain(h.Domain, h.Subdomains)
+}
+
+// Expired reports whether the host has an expiry that is not after now.
+func (h Host) Expired(now time.Time) bool {
+	return h.ExpiresAt != nil && !h.ExpiresAt.After(now)
+}
+
+// HostView is the host shape returned by list queries, with derived fields.
+type HostView struct {
+	Host
+	// ExpiresIn is the remaining lifetime in seconds, omitted for permanent hosts.
+	ExpiresIn *int64 `json:"expires_in,omitempty"`
+}
+
+// NewHostView builds the list view of a host relative to now.
+func NewHostView(h Host, now time.Time) HostView {
+	view := HostView{Host: h}
+	if h.ExpiresAt != nil {
+		remaining := int64(h.ExpiresAt.Sub(now).Seconds())
+		if remaining < 0 {
+			remaining = 0
+		}
+		view.ExpiresIn = &remaining
+	}
+	return view
 }
 
 // QueryHostResponse models the OpenAPI response for querying a single host.
@@ -22,9 +84,27 @@ type QueryHostListResponse struct {
 }
 
 // QueryHostListResult wraps the host list and total for list responses.
+// Total counts all matching hosts, List holds the requested page only.
 type QueryHostListResult struct {
-	Total int    `json:"total"`
-	List  []Host `json:"list"`
+	Total    int        `json:"total"`
+	List     []HostView `json:"list"`
+	Page     int        `json:"page,omitempty"`
+	PageSize int        `json:"pageSize,omitempty"`
+}
+
+// ListHostsQuery holds the filters, ordering and paging options of /host/list.
+// Zero values mean "no filter"; PageSize 0 returns every match.
+type ListHostsQuery struct {
+	Type     string `form:"type"`
+	Domain   string `form:"domain"` // substring match on the domain
+	Suffix   string `form:"suffix"` // suffix match on the domain, e.g. ".example.com"
+	IP       string `form:"ip"`     // matches any of the host's IPs
+	Enabled  *bool  `form:"enabled"`
+	Pinned   *bool  `form:"pinned"`
+	Sort     string `form:"sort"`  // domain (default), type, ip, expires_at
+	Order    string `form:"order"` // asc (default) or desc
+	Page     int    `form:"page"`
+	PageSize int    `form:"pageSize"`
 }
 
 // MutationResponse represents a response for create/delete operations.
@@ -33,9 +113,140 @@ type MutationResponse struct {
 	Message string `json:"message"`
 }
 
+// CreateHostResponse represents a response for host creation, carrying the created entry.
+type CreateHostResponse struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    Host   `json:"data"`
+}
+
 // AddHostRequest captures the expected payload when creating a host.
 type AddHostRequest struct {
-	Domain string `json:"domain"` // logical host name
+	Domain string `json:"domain"`         // logical host name
+	Type   string `json:"type,omitempty"` // optional CDN type, detected from resolved IPs when empty
+	// Subdomains is required for pattern domains such as "*.example.com"
+	Subdomains []string `json:"subdomains,omitempty"`
+	// TTL is an optional lifetime such as "2h"; mutually exclusive with ExpiresAt.
+	TTL string `json:"ttl,omitempty"`
+	// ExpiresAt is an optional absolute expiry time.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// UpdateHostRequest captures a partial update of a host. Nil fields are left unchanged.
+type UpdateHostRequest struct {
+	Domain string `json:"domain"`
+	// Type moves the host to another CDN type; unpinned hosts pick up its opt IPs.
+	Type *string `json:"type,omitempty"`
+	// IPs replaces the ordered IP list and pins the host unless Pinned is set to false.
+	IPs []string `json:"ips,omitempty"`
+	// IP is shorthand for a single-element IPs.
+	IP      *string `json:"ip,omitempty"`
+	Pinned  *bool   `json:"pinned,omitempty"`
+	Enabled *bool   `json:"enabled,omitempty"`
+	Notes   *string `json:"notes,omitempty"`
+}
+
+// Formats supported by host import and export.
+const (
+	FormatJSON  = "json"  // hosts.json shape
+	FormatHosts = "hosts" // hosts file lines
+	FormatCSV   = "csv"
+)
+
+// TransferQuery selects the format of /host/import and /host/export, and the
+// import mode: merge (default) upserts by domain, replace discards existing hosts.
+type TransferQuery struct {
+	Format string `form:"format"`
+	Mode   string `form:"mode"`
+}
+
+// ImportResult summarises an import. Errors carry the line number (entry index
+// for JSON) of every record that was rejected.
+type ImportResult struct {
+	Imported int                  `json:"imported"`
+	Failed   int                  `json:"failed"`
+	Errors   []hostsync.LineError `json:"errors"`
+}
+
+// HostExport is the rendered content of an export.
+type HostExport struct {
+	Content     []byte
+	ContentType string
+	Filename    string
+}
+
+// ImportHostsResponse models the response of /host/import.
+type ImportHostsResponse struct {
+	Code    int          `json:"code"`
+	Message string       `json:"message"`
+	Data    ImportResult `json:"data"`
+}
+
+// AdoptableHost is a domain found outside the managed section of the system
+// hosts file whose IPs fall in a known CDN range.
+type AdoptableHost struct {
+	Domain string   `json:"domain"`
+	IPs    []string `json:"ips"`
+	Type   string   `json:"type"`  // CDN type matched from the IPs
+	Lines  []int    `json:"lines"` // line numbers in the system hosts file
+}
+
+// AdoptHostsRequest selects the unmanaged domains to adopt.
+type AdoptHostsRequest struct {
+	Domains []string `json:"domains"`
+}
+
+// AdoptError explains why a domain could not be adopted.
+type AdoptError struct {
+	Domain string `json:"domain"`
+	Reason string `json:"reason"`
+}
+
+// AdoptResult lists the hosts created by an adoption and the domains that failed.
+type AdoptResult struct {
+	Adopted []Host       `json:"adopted"`
+	Errors  []AdoptError `json:"errors"`
+}
+
+// AdoptableHostsResponse models the response of GET /host/adoptable.
+type AdoptableHostsResponse struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    []AdoptableHost `json:"data"`
+}
+
+// AdoptHostsResponse models the response of POST /host/adopt.
+type AdoptHostsResponse struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    AdoptResult `json:"data"`
+}
+
+// SyncPreviewResponse models the response of GET /sync/preview.
+type SyncPreviewResponse struct {
+	Code    int                `json:"code"`
+	Message string             `json:"message"`
+	Data    *hostsync.SyncPlan `json:"data"`
+}
+
+// SyncStatusResponse models the response of GET /sync/status.
+type SyncStatusResponse struct {
+	Code    int                      `json:"code"`
+	Message string                   `json:"message"`
+	Data    hostsync.ReconcileStatus `json:"data"`
+}
+
+// PinHostRequest captures the payload for pinning a host to a manual IP.
+// IP is ignored when clearing the pin.
+type PinHostRequest struct {
+	Domain string `json:"domain"`
+	IP     string `json:"ip"`
+}
+
+// SetHostEnabledRequest captures the payload for enabling or disabling a host.
+type SetHostEnabledRequest struct {
+	Domain  string `json:"domain"`
+	Enabled *bool  `json:"enabled"`
 }
 
 // DeleteHostRequest captures the expected payload when removing a host.
@@ -0,0 +1,68 @@
+package host
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// ExpiryReaper periodically removes expired hosts and re-syncs the system hosts file.
+type ExpiryReaper struct {
+	svc      *Service
+	interval time.Duration
+	stop     chan struct{}
+	once     sync.Once
+}
+
+// NewExpiryReaper creates a reaper bound to the given host service.
+func NewExpiryReaper(svc *Service, interval time.Duration) *ExpiryReaper {
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+
+	return &ExpiryReaper{
+		svc:      svc,
+		interval: interval,
+		stop:     make(chan struct{}),
+	}
+}
+
+// Start runs the reap loop in a background goroutine.
+// An initial pass runs immediately so hosts that expired while the service was
+// down are removed on startup.
+func (r *ExpiryReaper) Start() {
+	go func() {
+		r.reap()
+
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				r.reap()
+			case <-r.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop terminates the reap loop.
+func (r *ExpiryReaper) Stop() {
+	r.once.Do(func() {
+		close(r.stop)
+	})
+}
+
+func (r *ExpiryReaper) reap() {
+	removed, err := r.svc.ReapExpired()
+	if err != nil {
+		log.Printf("Warning: failed to remove expired hosts: %v", err)
+		return
+	}
+
+	if len(removed) > 0 {
+		log.Printf("Removed %d expired host(s): %v", len(removed), removed)
+	}
+}
@@ -4,10 +4,12 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log"
 	"os"
 	"path/filepath"
 	"sort"
 	"sync"
+	"time"
 )
 
 var (
@@ -17,6 +19,25 @@ var (
 	ErrHostNotFound = errors.New("host not found")
 )
 
+// Repository is the storage used by Service. FileRepository keeps hosts in a
+// JSON file, SQLiteRepository in a SQLite database.
+type Repository interface {
+	// List returns all hosts ordered by domain.
+	List() ([]Host, error)
+	Get(domain string) (Host, error)
+	Create(host Host) error
+	Delete(domain string) error
+	ListByType(hostType string) ([]Host, error)
+	// Update applies mutate to a copy of the host and stores the result
+	// atomically; nothing is written if mutate returns an error.
+	Update(domain string, mutate func(*Host) error) (Host, error)
+	// Import upserts hosts by domain in one write, discarding the existing
+	// collection first when replace is set.
+	Import(hosts []Host, replace bool) error
+	// DeleteExpired removes hosts expired at or before now and returns them.
+	DeleteExpired(now time.Time) ([]Host, error)
+}
+
 // FileRepository manages hosts persisted in a JSON file to simulate /etc/hosts.
 type FileRepository struct {
 	Path  string // exported for use by Service to create syncer with same path
@@ -43,7 +64,7 @@ func NewFileRepository(path string) (*FileRepository, error) {
 }
 
 // List returns the complete host collection.
-func (r *FileRepository) List() []Host {
+func (r *FileRepository) List() ([]Host, error) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
@@ -56,7 +77,7 @@ func (r *FileRepository) List() []Host {
 		return result[i].Domain < result[j].Domain
 	})
 
-	return result
+	return result, nil
 }
 
 // Get fetches a host by domain.
@@ -101,7 +122,7 @@ func (r *FileRepository) Delete(domain string) error {
 }
 
 // ListByType returns all hosts with the specified type.
-func (r *FileRepository) ListByType(hostType string) []Host {
+func (r *FileRepository) ListByType(hostType string) ([]Host, error) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
@@ -112,23 +133,98 @@ func (r *FileRepository) ListByType(hostType string) []Host {
 		}
 	}
 
-	return result
+	return result, nil
 }
 
-// UpdateIP updates the IP address of a host by domain.
-func (r *FileRepository) UpdateIP(domain, newIP string) error {
+// Update applies mutate to a copy of the host and persists the result in a
+// single write. The stored entry is left untouched if mutate or the write fails.
+func (r *FileRepository) Update(domain string, mutate func(*Host) error) (Host, error) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	host, exists := r.hosts[domain]
+	current, exists := r.hosts[domain]
 	if !exists {
-		return ErrHostNotFound
+		return Host{}, ErrHostNotFound
 	}
 
-	host.IP = newIP
-	r.hosts[domain] = host
+	updated := current
+	updated.IPs = append([]string(nil), current.IPs...)
+	updated.Subdomains = append([]string(nil), current.Subdomains...)
+	if err := mutate(&updated); err != nil {
+		return Host{}, err
+	}
 
-	return r.persistLocked()
+	if err := checkUpdated(domain, &updated); err != nil {
+		return Host{}, err
+	}
+
+	r.hosts[domain] = updated
+	if err := r.persistLocked(); err != nil {
+		r.hosts[domain] = current
+		return Host{}, err
+	}
+
+	return updated, nil
+}
+
+// Import stores a batch of hosts in a single write. In replace mode the existing
+// collection is discarded first, otherwise hosts are upserted by domain.
+func (r *FileRepository) Import(hosts []Host, replace bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	previous := r.hosts
+	next := make(map[string]Host, len(previous)+len(hosts))
+	if !replace {
+		for domain, h := range previous {
+			next[domain] = h
+		}
+	}
+	for _, h := range hosts {
+		next[h.Domain] = h
+	}
+
+	r.hosts = next
+	if err := r.persistLocked(); err != nil {
+		r.hosts = previous
+		return err
+	}
+
+	return nil
+}
+
+// DeleteExpired removes every host that expired at or before now and returns
+// the removed hosts. The file is rewritten once for the whole batch.
+func (r *FileRepository) DeleteExpired(now time.Time) ([]Host, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	previous := r.hosts
+	next := make(map[string]Host, len(previous))
+	removed := make([]Host, 0)
+	for domain, h := range previous {
+		if h.Expired(now) {
+			removed = append(removed, h)
+			continue
+		}
+		next[domain] = h
+	}
+
+	if len(removed) == 0 {
+		return removed, nil
+	}
+
+	r.hosts = next
+	if err := r.persistLocked(); err != nil {
+		r.hosts = previous
+		return nil, err
+	}
+
+	sort.Slice(removed, func(i, j int) bool {
+		return removed[i].Domain < removed[j].Domain
+	})
+
+	return removed, nil
 }
 
 func (r *FileRepository) ensureFile() error {
@@ -159,13 +255,55 @@ func (r *FileRepository) load() error {
 		return err
 	}
 
+	migrated := 0
 	for _, h := range entries {
+		if migrateHost(&h) {
+			migrated++
+		}
 		r.hosts[h.Domain] = h
 	}
 
+	// 旧版本 hosts.json 只有单个 ip 字段，迁移后回写为新格式
+	if migrated > 0 {
+		log.Printf("Migrated %d host(s) in %s to multi-IP format", migrated, r.Path)
+		return r.persistLocked()
+	}
+
 	return nil
 }
 
+// checkUpdated rejects updates that rename the host or empty its IP list and
+// keeps IP in sync with IPs[0].
+func checkUpdated(domain string, h *Host) error {
+	if h.Domain != domain {
+		return errors.New("domain cannot be changed")
+	}
+	if len(h.IPs) == 0 {
+		return errors.New("ip list is empty")
+	}
+	h.IP = h.IPs[0]
+	return nil
+}
+
+// migrateHost upgrades a single-IP entry to the multi-IP format and keeps IP in
+// sync with IPs[0]. It reports whether the entry was changed.
+func migrateHost(h *Host) bool {
+	if len(h.IPs) == 0 {
+		if h.IP == "" {
+			return false
+		}
+		h.IPs = []string{h.IP}
+		return true
+	}
+
+	if h.IP != h.IPs[0] {
+		h.IP = h.IPs[0]
+		return true
+	}
+
+	return false
+}
+
 func (r *FileRepository) persistLocked() error {
 	entries := make([]Host, 0, len(r.hosts))
 	for _, h := range r.hosts {
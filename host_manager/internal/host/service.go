@@ -1,32 +1,259 @@
 package host
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"hostMgr/hostsync"
+	"hostMgr/internal/audit"
+	"hostMgr/internal/cdn"
 	"hostMgr/internal/extSvc"
 	"hostMgr/internal/opt"
+	"hostMgr/internal/revision"
+	"hostMgr/internal/tool"
 	"log"
+	"net"
+	"sort"
 	"strings"
+	"time"
 )
 
 // Service coordinates host operations and validation.
 type Service struct {
-	repo   *FileRepository
-	syncer *hostsync.Syncer
+	repo        Repository
+	index       *indexedRepository // repo itself, with the domain index used by LookupManaged
+	syncer      *hostsync.Syncer
+	detector    *cdn.Detector
+	resolver    tool.DNSResolver
+	defaultType string // 无法识别 CDN 类型时的兜底类型
+	fallbacks   int    // 每个 host 除主 IP 外保留的备用 IP 数量
+	audit       *audit.Logger
+	revisions   *revision.Manager
 }
 
-// NewService instantiates a host service.
-func NewService(repo *FileRepository) *Service {
-	return &Service{
-		repo:   repo,
-		syncer: hostsync.NewSyncer(repo.Path),
+// NewService instantiates a host service. The syncer is pointed at repo so the
+// system hosts file always reflects the configured storage.
+// detector may be nil, in which case hosts without an explicit type fall back to defaultType.
+func NewService(repo Repository, syncer *hostsync.Syncer, detector *cdn.Detector, defaultType string) *Service {
+	index := newIndexedRepository(repo)
+	s := &Service{
+		repo:        index,
+		index:       index,
+		syncer:      syncer,
+		detector:    detector,
+		resolver:    tool.NewDefaultDNSResolver(5 * time.Second),
+		defaultType: defaultType,
 	}
+	syncer.SetEntrySource(s.syncEntries)
+	return s
 }
 
-// ListHosts retrieves all registered hosts.
-func (s *Service) ListHosts() []Host {
-	return s.repo.List()
+// syncEntries lists the stored hosts in the shape written by the syncer.
+func (s *Service) syncEntries() ([]hostsync.HostEntry, error) {
+	hosts, err := s.repo.List()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]hostsync.HostEntry, 0, len(hosts))
+	for _, h := range hosts {
+		entries = append(entries, toEntry(h))
+	}
+	return entries, nil
+}
+
+// SetDNSResolver sets a custom DNS resolver used for CDN type detection.
+func (s *Service) SetDNSResolver(resolver tool.DNSResolver) {
+	s.resolver = resolver
+}
+
+// SetAuditLogger sets the logger that records every host change.
+func (s *Service) SetAuditLogger(logger *audit.Logger) {
+	s.audit = logger
+}
+
+// SetRevisions registers the hosts with the revision manager, which then
+// snapshots them after every change.
+func (s *Service) SetRevisions(m *revision.Manager) {
+	s.revisions = m
+	m.AddSource("hosts", revision.Source{
+		Snapshot: func() (map[string]interface{}, error) {
+			hosts, err := s.repo.List()
+			if err != nil {
+				return nil, err
+			}
+			items := make(map[string]interface{}, len(hosts))
+			for _, h := range hosts {
+				items[h.Domain] = h
+			}
+			return items, nil
+		},
+		Decode: func(items map[string]json.RawMessage) (func() error, error) {
+			hosts := make([]Host, 0, len(items))
+			for domain, raw := range items {
+				var h Host
+				if err := json.Unmarshal(raw, &h); err != nil {
+					return nil, fmt.Errorf("host %s: %w", domain, err)
+				}
+				hosts = append(hosts, h)
+			}
+			return func() error { return s.repo.Import(hosts, true) }, nil
+		},
+	})
+}
+
+// SetFallbackCount sets how many fallback IPs each host keeps besides the primary.
+func (s *Service) SetFallbackCount(n int) {
+	if n < 0 {
+		n = 0
+	}
+	s.fallbacks = n
+}
+
+// maxPageSize caps the page size accepted by QueryHosts.
+const maxPageSize = 500
+
+// ListHosts retrieves all registered hosts along with their remaining lifetime.
+func (s *Service) ListHosts() []HostView {
+	result, _ := s.QueryHosts(ListHostsQuery{})
+	return result.List
+}
+
+// QueryHosts filters, sorts and pages the registered hosts.
+// Total in the result is the number of matches before paging.
+func (s *Service) QueryHosts(q ListHostsQuery) (QueryHostListResult, error) {
+	less, err := hostComparator(q.Sort, q.Order)
+	if err != nil {
+		return QueryHostListResult{}, err
+	}
+	if q.Page < 0 || q.PageSize < 0 {
+		return QueryHostListResult{}, errors.New("page and pageSize must not be negative")
+	}
+	if q.PageSize > maxPageSize {
+		return QueryHostListResult{}, fmt.Errorf("pageSize must not exceed %d", maxPageSize)
+	}
+
+	q.Type = strings.TrimSpace(q.Type)
+	q.Domain = normalizeDomain(q.Domain)
+	q.Suffix = normalizeDomain(q.Suffix)
+	q.IP = strings.TrimSpace(q.IP)
+
+	hosts, err := s.repo.List()
+	if err != nil {
+		return QueryHostListResult{}, err
+	}
+
+	matched := make([]Host, 0)
+	for _, h := range hosts {
+		if matchHost(h, q) {
+			matched = append(matched, h)
+		}
+	}
+
+	sort.SliceStable(matched, func(i, j int) bool {
+		return less(matched[i], matched[j])
+	})
+
+	result := QueryHostListResult{Total: len(matched)}
+	if q.PageSize > 0 {
+		if q.Page == 0 {
+			q.Page = 1
+		}
+		start := (q.Page - 1) * q.PageSize
+		end := start + q.PageSize
+		if start > len(matched) {
+			start = len(matched)
+		}
+		if end > len(matched) {
+			end = len(matched)
+		}
+		matched = matched[start:end]
+		result.Page = q.Page
+		result.PageSize = q.PageSize
+	}
+
+	now := time.Now()
+	result.List = make([]HostView, 0, len(matched))
+	for _, h := range matched {
+		result.List = append(result.List, NewHostView(h, now))
+	}
+
+	return result, nil
+}
+
+// matchHost reports whether the host passes every filter set in q.
+func matchHost(h Host, q ListHostsQuery) bool {
+	if q.Type != "" && h.Type != q.Type {
+		return false
+	}
+	if q.Domain != "" && !strings.Contains(h.Domain, q.Domain) {
+		return false
+	}
+	if q.Suffix != "" && !strings.HasSuffix(h.Domain, q.Suffix) {
+		return false
+	}
+	if q.IP != "" && !containsString(h.IPs, q.IP) {
+		return false
+	}
+	if q.Enabled != nil && h.Enabled != *q.Enabled {
+		return false
+	}
+	if q.Pinned != nil && h.Pinned != *q.Pinned {
+		return false
+	}
+	return true
+}
+
+// hostComparator returns the ordering for the given sort field and direction.
+// Ties are always broken by domain so paging is stable.
+func hostComparator(field, order string) (func(a, b Host) bool, error) {
+	var key func(a, b Host) int
+	switch strings.ToLower(strings.TrimSpace(field)) {
+	case "", "domain":
+		key = func(a, b Host) int { return strings.Compare(a.Domain, b.Domain) }
+	case "type":
+		key = func(a, b Host) int { return strings.Compare(a.Type, b.Type) }
+	case "ip":
+		key = func(a, b Host) int { return strings.Compare(a.IP, b.IP) }
+	case "expires_at":
+		key = func(a, b Host) int { return compareExpiry(a.ExpiresAt, b.ExpiresAt) }
+	default:
+		return nil, fmt.Errorf("invalid sort field %s, supported: domain, type, ip, expires_at", field)
+	}
+
+	desc := false
+	switch strings.ToLower(strings.TrimSpace(order)) {
+	case "", "asc":
+	case "desc":
+		desc = true
+	default:
+		return nil, fmt.Errorf("invalid order %s, supported: asc, desc", order)
+	}
+
+	return func(a, b Host) bool {
+		c := key(a, b)
+		if c == 0 {
+			return a.Domain < b.Domain
+		}
+		if desc {
+			return c > 0
+		}
+		return c < 0
+	}, nil
+}
+
+// compareExpiry orders expiring hosts by time, permanent hosts last.
+func compareExpiry(a, b *time.Time) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return 1
+	case b == nil:
+		return -1
+	default:
+		return a.Compare(*b)
+	}
 }
 
 // GetHost returns the host by domain or a wrapped error if missing.
@@ -44,58 +271,170 @@ func (s *Service) GetHost(domain string) (Host, error) {
 	return host, nil
 }
 
+// LookupManaged returns the IPs of the enabled, unexpired host covering
+// domain, primary first. Lookups use an index of the hosts that every write
+// invalidates, so opt rotations are visible immediately.
+func (s *Service) LookupManaged(domain string) ([]string, bool) {
+	domain = normalizeDomain(domain)
+	if domain == "" {
+		return nil, false
+	}
+	return s.index.lookup(domain, time.Now())
+}
+
 // CreateHost validates and registers a new host entry.
-func (s *Service) CreateHost(req AddHostRequest) error {
-	cdnType := "cloudflare"
+// When req.Type is empty the CDN type is detected from the domain's resolved IPs.
+func (s *Service) CreateHost(req AddHostRequest, cause audit.Cause) (Host, error) {
+	cause = cause.Or("host created")
+	host, err := s.createHost(req, cause)
+	if err != nil {
+		return Host{}, err
+	}
+
+	s.revisions.Capture(cause)
+
+	// 同步到系统 hosts 文件
+	if err := s.syncer.Sync(); err != nil {
+		log.Printf("Warning: failed to sync hosts to system: %v", err)
+		return Host{}, err
+	}
+
+	return host, nil
+}
+
+// createHost validates and stores a new host without syncing the system hosts file.
+func (s *Service) createHost(req AddHostRequest, cause audit.Cause) (Host, error) {
 	req.Domain = normalizeDomain(req.Domain)
 	if req.Domain == "" {
-		return errors.New("domain is required")
+		return Host{}, errors.New("domain is required")
+	}
+	if err := validateDomain(req.Domain); err != nil {
+		return Host{}, err
 	}
 
 	optSvc, ok := extSvc.OptService.(*opt.Service)
 	if !ok || optSvc == nil {
-		return errors.New("opt service not initialized")
+		return Host{}, errors.New("opt service not initialized")
 	}
 
-	_, optIp, err := optSvc.GetCurrentOpt(cdnType)
+	subdomains, err := normalizeSubdomains(req.Domain, req.Subdomains)
 	if err != nil {
-		return err
+		return Host{}, err
+	}
+
+	expiresAt, err := resolveExpiry(req.TTL, req.ExpiresAt, time.Now())
+	if err != nil {
+		return Host{}, err
+	}
+
+	domains := hostsync.ExpandDomain(req.Domain, subdomains)
+	if err := s.checkConflicts(req.Domain, domains); err != nil {
+		return Host{}, err
+	}
+
+	// 模式条目使用第一个展开后的域名进行 CDN 识别
+	cdnType, err := s.resolveType(optSvc, domains[0], req.Type)
+	if err != nil {
+		return Host{}, err
+	}
+
+	ips, err := s.candidateIPs(optSvc, cdnType)
+	if err != nil {
+		return Host{}, err
 	}
 	host := Host{
-		Domain: req.Domain,
-		IP:     optIp.IP,
-		Type:   cdnType,
+		Domain:     req.Domain,
+		IP:         ips[0],
+		IPs:        ips,
+		Type:       cdnType,
+		Subdomains: subdomains,
+		Enabled:    true,
+		ExpiresAt:  expiresAt,
 	}
 
 	if err := s.repo.Create(host); err != nil {
 		if errors.Is(err, ErrHostExists) {
-			return fmt.Errorf("host %s already exists", req.Domain)
+			return Host{}, fmt.Errorf("host %s already exists", req.Domain)
 		}
-		return err
+		return Host{}, err
 	}
+	s.audit.Record(cause, audit.ActionHostCreate, host.Domain, nil, host)
 
-	// 同步到系统 hosts 文件
-	if err := s.syncer.Sync(); err != nil {
-		log.Printf("Warning: failed to sync hosts to system: %v", err)
-		return err
+	return host, nil
+}
+
+// resolveType validates the requested type or detects one for the domain.
+// The chosen type must have opt data, otherwise no IP can be assigned.
+func (s *Service) resolveType(optSvc *opt.Service, domain, requested string) (string, error) {
+	available := optSvc.GetAllTypes()
+	sort.Strings(available)
+
+	requested = strings.TrimSpace(requested)
+	if requested != "" {
+		if !containsString(available, requested) {
+			return "", fmt.Errorf("invalid type %s, available types: [%s]", requested, strings.Join(available, ", "))
+		}
+		return requested, nil
 	}
 
-	return nil
+	cdnType := s.detectType(domain)
+	if cdnType == "" {
+		cdnType = s.defaultType
+	}
+	if cdnType == "" {
+		return "", fmt.Errorf("unable to detect CDN type for %s, please specify type", domain)
+	}
+
+	if !containsString(available, cdnType) {
+		return "", fmt.Errorf("no opt data for type %s (domain %s), available types: [%s]", cdnType, domain, strings.Join(available, ", "))
+	}
+
+	return cdnType, nil
+}
+
+// detectType resolves the domain and matches the IPs against known CDN ranges.
+// It returns an empty string when the type cannot be determined.
+func (s *Service) detectType(domain string) string {
+	if s.detector == nil || s.resolver == nil {
+		return ""
+	}
+
+	ips, err := s.resolver.ResolveDomain(domain)
+	if err != nil {
+		log.Printf("Warning: failed to resolve %s for CDN detection: %v", domain, err)
+		return ""
+	}
+
+	cdnType, ok := s.detector.Detect(ips)
+	if !ok {
+		log.Printf("No known CDN range matched %s (ips=%v)", domain, ips)
+		return ""
+	}
+
+	return cdnType
 }
 
 // DeleteHost removes a host by domain.
-func (s *Service) DeleteHost(domain string) error {
+func (s *Service) DeleteHost(domain string, cause audit.Cause) error {
+	cause = cause.Or("host deleted")
 	domain = normalizeDomain(domain)
 	if domain == "" {
 		return errors.New("domain is required")
 	}
 
-	if err := s.repo.Delete(domain); err != nil {
+	current, err := s.repo.Get(domain)
+	if err == nil {
+		err = s.repo.Delete(domain)
+	}
+	if err != nil {
 		if errors.Is(err, ErrHostNotFound) {
 			return fmt.Errorf("host %s not found", domain)
 		}
 		return err
 	}
+	s.audit.Record(cause, audit.ActionHostDelete, domain, current, nil)
+
+	s.revisions.Capture(cause)
 
 	// 同步到系统 hosts 文件
 	if err := s.syncer.Sync(); err != nil {
@@ -105,42 +444,297 @@ func (s *Service) DeleteHost(domain string) error {
 	return nil
 }
 
-// UpdateHostsByType updates the IP address for all hosts of the specified type.
-// It fetches the current optimal IP for the given type from opt service,
-// then updates all hosts with that type to use this IP.
-func (s *Service) UpdateHostsByType(hostType string) (int, error) {
+// UpdateHost applies a partial update to a host in one write and syncs once.
+func (s *Service) UpdateHost(req UpdateHostRequest, cause audit.Cause) (Host, error) {
+	cause = cause.Or("host updated")
+	domain := normalizeDomain(req.Domain)
+	if domain == "" {
+		return Host{}, errors.New("domain is required")
+	}
+
+	current, err := s.repo.Get(domain)
+	if err != nil {
+		return Host{}, fmt.Errorf("host %s not found", domain)
+	}
+
+	ips, err := normalizeIPs(req.IP, req.IPs)
+	if err != nil {
+		return Host{}, err
+	}
+
+	// 指定 IP 时默认固定，避免下次优选轮换时被覆盖
+	pinned := current.Pinned
+	if len(ips) > 0 {
+		pinned = true
+	}
+	if req.Pinned != nil {
+		pinned = *req.Pinned
+	}
+
+	hostType := current.Type
+	if req.Type != nil {
+		hostType = strings.TrimSpace(*req.Type)
+	}
+
+	optSvc, ok := extSvc.OptService.(*opt.Service)
+	if !ok || optSvc == nil {
+		return Host{}, errors.New("opt service not initialized")
+	}
+
+	if hostType != current.Type {
+		available := optSvc.GetAllTypes()
+		sort.Strings(available)
+		if !containsString(available, hostType) {
+			return Host{}, fmt.Errorf("invalid type %s, available types: [%s]", hostType, strings.Join(available, ", "))
+		}
+	}
+
+	// 未手动指定 IP 且类型变化或取消固定时，改用该类型当前的优选 IP
+	if len(ips) == 0 && !pinned && (hostType != current.Type || current.Pinned) {
+		ips, err = s.candidateIPs(optSvc, hostType)
+		if err != nil {
+			return Host{}, fmt.Errorf("failed to get current opt for type %s: %w", hostType, err)
+		}
+	}
+
+	updated, err := s.update(domain, cause, func(h *Host) error {
+		h.Type = hostType
+		h.Pinned = pinned
+		if len(ips) > 0 {
+			h.IPs = ips
+		}
+		if req.Enabled != nil {
+			h.Enabled = *req.Enabled
+		}
+		if req.Notes != nil {
+			h.Notes = strings.TrimSpace(*req.Notes)
+		}
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, ErrHostNotFound) {
+			return Host{}, fmt.Errorf("host %s not found", domain)
+		}
+		return Host{}, err
+	}
+
+	s.revisions.Capture(cause)
+
+	// 同步到系统 hosts 文件
+	if err := s.syncer.Sync(); err != nil {
+		log.Printf("Warning: failed to sync hosts to system: %v", err)
+	}
+
+	return updated, nil
+}
+
+// ReapExpired removes expired hosts and re-syncs the system hosts file when
+// anything was removed. It returns the removed domains.
+func (s *Service) ReapExpired() ([]string, error) {
+	expired, err := s.repo.DeleteExpired(time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	cause := audit.Cause{Actor: audit.ActorScheduler, Reason: "host expired"}
+	removed := make([]string, 0, len(expired))
+	for _, h := range expired {
+		s.audit.Record(cause, audit.ActionHostDelete, h.Domain, h, nil)
+		removed = append(removed, h.Domain)
+	}
+
+	if len(removed) > 0 {
+		s.revisions.Capture(cause)
+
+		// 同步到系统 hosts 文件
+		if err := s.syncer.Sync(); err != nil {
+			log.Printf("Warning: failed to sync hosts to system: %v", err)
+		}
+	}
+
+	return removed, nil
+}
+
+// PreviewSync returns the diff a sync would apply to the system hosts file
+// without writing anything.
+func (s *Service) PreviewSync() (*hostsync.SyncPlan, error) {
+	return s.syncer.Plan()
+}
+
+// SetHostEnabled switches a host on or off without deleting it.
+// Disabled hosts are left out of the system hosts file but kept in hosts.json.
+func (s *Service) SetHostEnabled(domain string, enabled bool, cause audit.Cause) (Host, error) {
+	domain = normalizeDomain(domain)
+	if domain == "" {
+		return Host{}, errors.New("domain is required")
+	}
+
+	if enabled {
+		cause = cause.Or("host enabled")
+	} else {
+		cause = cause.Or("host disabled")
+	}
+	updated, err := s.update(domain, cause, func(h *Host) error {
+		h.Enabled = enabled
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, ErrHostNotFound) {
+			return Host{}, fmt.Errorf("host %s not found", domain)
+		}
+		return Host{}, err
+	}
+
+	s.revisions.Capture(cause)
+
+	// 同步到系统 hosts 文件
+	if err := s.syncer.Sync(); err != nil {
+		log.Printf("Warning: failed to sync hosts to system: %v", err)
+	}
+
+	return updated, nil
+}
+
+// PinHost pins a host to a hand-picked IP so that opt rotation leaves it alone.
+func (s *Service) PinHost(domain, ip string, cause audit.Cause) (Host, error) {
+	cause = cause.Or("host pinned")
+	domain = normalizeDomain(domain)
+	if domain == "" {
+		return Host{}, errors.New("domain is required")
+	}
+
+	ip = strings.TrimSpace(ip)
+	if net.ParseIP(ip) == nil {
+		return Host{}, fmt.Errorf("invalid ip %q", ip)
+	}
+
+	updated, err := s.update(domain, cause, func(h *Host) error {
+		h.Pinned = true
+		h.IPs = []string{ip}
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, ErrHostNotFound) {
+			return Host{}, fmt.Errorf("host %s not found", domain)
+		}
+		return Host{}, err
+	}
+
+	s.revisions.Capture(cause)
+
+	// 同步到系统 hosts 文件
+	if err := s.syncer.Sync(); err != nil {
+		log.Printf("Warning: failed to sync hosts to system: %v", err)
+	}
+
+	return updated, nil
+}
+
+// UnpinHost clears the pin and moves the host back onto the current opt IPs of its type.
+func (s *Service) UnpinHost(domain string, cause audit.Cause) (Host, error) {
+	cause = cause.Or("host unpinned")
+	domain = normalizeDomain(domain)
+	if domain == "" {
+		return Host{}, errors.New("domain is required")
+	}
+
+	optSvc, ok := extSvc.OptService.(*opt.Service)
+	if !ok || optSvc == nil {
+		return Host{}, errors.New("opt service not initialized")
+	}
+
+	// 读取类型与写入之间类型可能被修改, 此时按新类型重试
+	var updated Host
+	for attempt := 0; ; attempt++ {
+		current, err := s.repo.Get(domain)
+		if err != nil {
+			if errors.Is(err, ErrHostNotFound) {
+				return Host{}, fmt.Errorf("host %s not found", domain)
+			}
+			return Host{}, err
+		}
+
+		ips, err := s.candidateIPs(optSvc, current.Type)
+		if err != nil {
+			return Host{}, fmt.Errorf("failed to get current opt for type %s: %w", current.Type, err)
+		}
+
+		updated, err = s.update(domain, cause, func(h *Host) error {
+			if h.Type != current.Type {
+				return errSkipUpdate
+			}
+			h.Pinned = false
+			h.IPs = ips
+			return nil
+		})
+		if errors.Is(err, errSkipUpdate) && attempt < 2 {
+			continue
+		}
+		if errors.Is(err, ErrHostNotFound) {
+			return Host{}, fmt.Errorf("host %s not found", domain)
+		}
+		if err != nil {
+			return Host{}, err
+		}
+		break
+	}
+
+	s.revisions.Capture(cause)
+
+	// 同步到系统 hosts 文件
+	if err := s.syncer.Sync(); err != nil {
+		log.Printf("Warning: failed to sync hosts to system: %v", err)
+	}
+
+	return updated, nil
+}
+
+// UpdateHostsByType updates the IP list for all hosts of the specified type.
+// It fetches the current optimal IP and its fallbacks for the given type from
+// opt service, then updates all hosts with that type to use this list.
+// Pinned hosts keep their manual IPs and are skipped.
+func (s *Service) UpdateHostsByType(hostType string, cause audit.Cause) (int, error) {
 	if hostType == "" {
 		return 0, errors.New("host type is required")
 	}
 
-	// Get current optimal IP for the specified type
+	// Get current optimal IPs for the specified type
 	optSvc, ok := extSvc.OptService.(*opt.Service)
 	if !ok || optSvc == nil {
 		return 0, errors.New("opt service not initialized")
 	}
 
-	_, optInfo, err := optSvc.GetCurrentOpt(hostType)
+	newIPs, err := s.candidateIPs(optSvc, hostType)
 	if err != nil {
 		return 0, fmt.Errorf("failed to get current opt for type %s: %w", hostType, err)
 	}
 
-	newIP := optInfo.IP
-	if newIP == "" {
-		return 0, fmt.Errorf("no IP found for type %s", hostType)
-	}
-
 	// Get all hosts with the specified type
-	hosts := s.repo.ListByType(hostType)
+	hosts, err := s.repo.ListByType(hostType)
+	if err != nil {
+		return 0, err
+	}
 	if len(hosts) == 0 {
 		return 0, fmt.Errorf("no hosts found with type %s", hostType)
 	}
 
-	// Update each host's IP
+	// Update each host's IPs
 	updatedCount := 0
 	var updateErrors []string
 
 	for _, host := range hosts {
-		if err := s.repo.UpdateIP(host.Domain, newIP); err != nil {
+		// 列出之后 host 可能被固定或改为其他类型, 在写入时再次检查
+		_, err := s.update(host.Domain, cause, func(h *Host) error {
+			if h.Pinned || h.Type != hostType {
+				return errSkipUpdate
+			}
+			h.IPs = append([]string(nil), newIPs...)
+			return nil
+		})
+		if errors.Is(err, errSkipUpdate) {
+			continue
+		}
+		if err != nil {
 			updateErrors = append(updateErrors, fmt.Sprintf("failed to update %s: %v", host.Domain, err))
 		} else {
 			updatedCount++
@@ -148,13 +742,215 @@ func (s *Service) UpdateHostsByType(hostType string) (int, error) {
 	}
 
 	if len(updateErrors) > 0 {
-		return updatedCount, fmt.Errorf("updated %d hosts with IP %s, but encountered errors: %s", updatedCount, newIP, strings.Join(updateErrors, "; "))
+		return updatedCount, fmt.Errorf("updated %d hosts with IP %s, but encountered errors: %s", updatedCount, newIPs[0], strings.Join(updateErrors, "; "))
 	}
 
 	return updatedCount, nil
 }
 
+// errSkipUpdate is returned by an update mutation that finds the stored host
+// no longer matches what the caller inspected; nothing is written.
+var errSkipUpdate = errors.New("host changed, update skipped")
+
+// update applies mutate through the repository and records the change with the
+// host's state before and after it.
+func (s *Service) update(domain string, cause audit.Cause, mutate func(*Host) error) (Host, error) {
+	var before Host
+	updated, err := s.repo.Update(domain, func(h *Host) error {
+		before = *h
+		return mutate(h)
+	})
+	if err != nil {
+		return Host{}, err
+	}
+
+	s.audit.Record(cause, audit.ActionHostUpdate, domain, before, updated)
+	return updated, nil
+}
+
+// candidateIPs returns the current opt IP for the type followed by up to
+// s.fallbacks further IPs from the opt list.
+func (s *Service) candidateIPs(optSvc *opt.Service, hostType string) ([]string, error) {
+	opts, err := optSvc.GetCandidates(hostType, s.fallbacks+1)
+	if err != nil {
+		return nil, err
+	}
+
+	ips := make([]string, 0, len(opts))
+	for _, o := range opts {
+		if o.IP != "" {
+			ips = append(ips, o.IP)
+		}
+	}
+
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("no IP found for type %s", hostType)
+	}
+
+	return ips, nil
+}
+
+// normalizeIPs merges the single-IP shorthand with the IP list and validates
+// every address. It returns nil when neither is given.
+func normalizeIPs(ip *string, ips []string) ([]string, error) {
+	if ip != nil {
+		if len(ips) > 0 {
+			return nil, errors.New("ip and ips are mutually exclusive")
+		}
+		ips = []string{*ip}
+	}
+
+	result := make([]string, 0, len(ips))
+	seen := make(map[string]bool, len(ips))
+	for _, candidate := range ips {
+		candidate = strings.TrimSpace(candidate)
+		if net.ParseIP(candidate) == nil {
+			return nil, fmt.Errorf("invalid ip %q", candidate)
+		}
+		if seen[candidate] {
+			continue
+		}
+		seen[candidate] = true
+		result = append(result, candidate)
+	}
+
+	if len(result) == 0 {
+		return nil, nil
+	}
+
+	return result, nil
+}
+
+// resolveExpiry turns an optional TTL or absolute expiry into an expiry time.
+// It returns nil for permanent hosts.
+func resolveExpiry(ttl string, expiresAt *time.Time, now time.Time) (*time.Time, error) {
+	ttl = strings.TrimSpace(ttl)
+	if ttl != "" && expiresAt != nil {
+		return nil, errors.New("ttl and expires_at are mutually exclusive")
+	}
+
+	if ttl != "" {
+		duration, err := time.ParseDuration(ttl)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ttl %q: %w", ttl, err)
+		}
+		if duration <= 0 {
+			return nil, fmt.Errorf("ttl must be positive, got %s", ttl)
+		}
+		at := now.Add(duration)
+		return &at, nil
+	}
+
+	if expiresAt != nil {
+		if !expiresAt.After(now) {
+			return nil, fmt.Errorf("expires_at %s is in the past", expiresAt.Format(time.RFC3339))
+		}
+		at := *expiresAt
+		return &at, nil
+	}
+
+	return nil, nil
+}
+
+// normalizeSubdomains validates the subdomain list against the domain kind.
+// Pattern domains need at least one label, plain domains must not carry any.
+func normalizeSubdomains(domain string, subdomains []string) ([]string, error) {
+	if !hostsync.IsPattern(domain) {
+		if len(subdomains) > 0 {
+			return nil, fmt.Errorf("subdomains are only allowed for pattern domains like *.%s", domain)
+		}
+		return nil, nil
+	}
+
+	base := strings.TrimPrefix(domain, "*.")
+	if base == "" || strings.Contains(base, "*") {
+		return nil, fmt.Errorf("invalid pattern domain %s", domain)
+	}
+
+	result := make([]string, 0, len(subdomains))
+	seen := make(map[string]bool, len(subdomains))
+	for _, sub := range subdomains {
+		sub = strings.Trim(normalizeDomain(sub), ".")
+		if !isDNSName(sub) || !isDNSName(sub+"."+base) {
+			return nil, fmt.Errorf("invalid subdomain %q for %s", sub, domain)
+		}
+		if seen[sub] {
+			continue
+		}
+		seen[sub] = true
+		result = append(result, sub)
+	}
+
+	if len(result) == 0 {
+		return nil, fmt.Errorf("pattern domain %s requires at least one subdomain", domain)
+	}
+
+	return result, nil
+}
+
+// checkConflicts rejects entries whose concrete domains are already covered by
+// another host, which would produce duplicate lines in the hosts file.
+func (s *Service) checkConflicts(domain string, domains []string) error {
+	hosts, err := s.repo.List()
+	if err != nil {
+		return err
+	}
+
+	covered := make(map[string]string)
+	for _, h := range hosts {
+		for _, d := range h.Domains() {
+			covered[d] = h.Domain
+		}
+	}
+
+	for _, d := range domains {
+		if owner, ok := covered[d]; ok && owner != domain {
+			return fmt.Errorf("domain %s is already managed by %s", d, owner)
+		}
+	}
+
+	return nil
+}
+
 func normalizeDomain(domain string) string {
 	domain = strings.TrimSpace(strings.ToLower(domain))
 	return domain
 }
+
+// validateDomain checks that domain is a DNS name, optionally a "*." pattern,
+// since it is written verbatim into the hosts file and resolver configs.
+func validateDomain(domain string) error {
+	if !isDNSName(strings.TrimPrefix(domain, "*.")) {
+		return fmt.Errorf("invalid domain %q", domain)
+	}
+	return nil
+}
+
+// isDNSName reports whether name consists of dot-separated labels of 1-63
+// lowercase letters, digits and hyphens.
+func isDNSName(name string) bool {
+	if name == "" || len(name) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(name, ".") {
+		if len(label) == 0 || len(label) > 63 {
+			return false
+		}
+		for i := 0; i < len(label); i++ {
+			c := label[i]
+			if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func containsString(list []string, target string) bool {
+	for _, item := range list {
+		if item == target {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,328 @@
+package host
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// SQLiteRepository stores hosts in a SQLite database. List columns such as
+// ips and subdomains are kept as JSON arrays.
+type SQLiteRepository struct {
+	db *sql.DB
+}
+
+var (
+	_ Repository = (*FileRepository)(nil)
+	_ Repository = (*SQLiteRepository)(nil)
+)
+
+const hostColumns = `domain, ip, ips, type, subdomains, pinned, enabled, expires_at, notes`
+
+// NewSQLiteRepository creates the hosts table if needed and returns a repository backed by db.
+func NewSQLiteRepository(db *sql.DB) (*SQLiteRepository, error) {
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS hosts (
+		domain     TEXT PRIMARY KEY,
+		ip         TEXT NOT NULL,
+		ips        TEXT NOT NULL DEFAULT '[]',
+		type       TEXT NOT NULL,
+		subdomains TEXT NOT NULL DEFAULT '[]',
+		pinned     INTEGER NOT NULL DEFAULT 0,
+		enabled    INTEGER NOT NULL DEFAULT 1,
+		expires_at TEXT,
+		notes      TEXT NOT NULL DEFAULT ''
+	)`); err != nil {
+		return nil, fmt.Errorf("create hosts table: %w", err)
+	}
+
+	if _, err := db.Exec(`CREATE INDEX IF NOT EXISTS idx_hosts_type ON hosts (type)`); err != nil {
+		return nil, fmt.Errorf("create hosts index: %w", err)
+	}
+
+	return &SQLiteRepository{db: db}, nil
+}
+
+// List returns the complete host collection ordered by domain.
+func (r *SQLiteRepository) List() ([]Host, error) {
+	return r.query(`SELECT ` + hostColumns + ` FROM hosts ORDER BY domain`)
+}
+
+// Get fetches a host by domain.
+func (r *SQLiteRepository) Get(domain string) (Host, error) {
+	return scanHost(r.db.QueryRow(`SELECT `+hostColumns+` FROM hosts WHERE domain = ?`, domain))
+}
+
+// Create persists a new host entry.
+func (r *SQLiteRepository) Create(host Host) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var exists int
+	err = tx.QueryRow(`SELECT 1 FROM hosts WHERE domain = ?`, host.Domain).Scan(&exists)
+	if err == nil {
+		return ErrHostExists
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	if err := upsertHost(tx, host); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Delete removes a host by domain.
+func (r *SQLiteRepository) Delete(domain string) error {
+	res, err := r.db.Exec(`DELETE FROM hosts WHERE domain = ?`, domain)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrHostNotFound
+	}
+
+	return nil
+}
+
+// ListByType returns all hosts with the specified type.
+func (r *SQLiteRepository) ListByType(hostType string) ([]Host, error) {
+	return r.query(`SELECT `+hostColumns+` FROM hosts WHERE type = ? ORDER BY domain`, hostType)
+}
+
+// Update applies mutate to the stored host inside a transaction, so concurrent
+// updates of the same host cannot interleave.
+func (r *SQLiteRepository) Update(domain string, mutate func(*Host) error) (Host, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return Host{}, err
+	}
+	defer tx.Rollback()
+
+	updated, err := scanHost(tx.QueryRow(`SELECT `+hostColumns+` FROM hosts WHERE domain = ?`, domain))
+	if err != nil {
+		return Host{}, err
+	}
+
+	if err := mutate(&updated); err != nil {
+		return Host{}, err
+	}
+
+	if err := checkUpdated(domain, &updated); err != nil {
+		return Host{}, err
+	}
+
+	if err := upsertHost(tx, updated); err != nil {
+		return Host{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Host{}, err
+	}
+
+	return updated, nil
+}
+
+// Import stores a batch of hosts in a single transaction. In replace mode the
+// existing collection is discarded first, otherwise hosts are upserted by domain.
+func (r *SQLiteRepository) Import(hosts []Host, replace bool) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if replace {
+		if _, err := tx.Exec(`DELETE FROM hosts`); err != nil {
+			return err
+		}
+	}
+
+	for _, h := range hosts {
+		if err := upsertHost(tx, h); err != nil {
+			return fmt.Errorf("store %s: %w", h.Domain, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// DeleteExpired removes every host that expired at or before now and returns
+// the removed hosts.
+func (r *SQLiteRepository) DeleteExpired(now time.Time) ([]Host, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// expires_at 以 RFC3339 文本存储且时区不固定，在 Go 侧比较而不是依赖字符串排序
+	rows, err := tx.Query(`SELECT ` + hostColumns + ` FROM hosts WHERE expires_at IS NOT NULL ORDER BY domain`)
+	if err != nil {
+		return nil, err
+	}
+
+	removed := make([]Host, 0)
+	for rows.Next() {
+		h, err := scanHost(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if h.Expired(now) {
+			removed = append(removed, h)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, h := range removed {
+		if _, err := tx.Exec(`DELETE FROM hosts WHERE domain = ?`, h.Domain); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return removed, nil
+}
+
+// ImportJSON copies the hosts of a hosts.json file into the database, upgrading
+// single-IP entries on the way. A missing file imports nothing.
+func (r *SQLiteRepository) ImportJSON(path string) (int, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	var entries []Host
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &entries); err != nil {
+			return 0, fmt.Errorf("parse %s: %w", path, err)
+		}
+	}
+
+	hosts := make([]Host, 0, len(entries))
+	for _, h := range entries {
+		migrateHost(&h)
+		if len(h.IPs) == 0 {
+			continue
+		}
+		hosts = append(hosts, h)
+	}
+
+	if err := r.Import(hosts, false); err != nil {
+		return 0, err
+	}
+
+	return len(hosts), nil
+}
+
+func (r *SQLiteRepository) query(query string, args ...interface{}) ([]Host, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]Host, 0)
+	for rows.Next() {
+		h, err := scanHost(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, h)
+	}
+
+	return result, rows.Err()
+}
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanHost(row rowScanner) (Host, error) {
+	var (
+		h               Host
+		ips, subdomains string
+		expiresAt       sql.NullString
+		pinned, enabled bool
+	)
+
+	err := row.Scan(&h.Domain, &h.IP, &ips, &h.Type, &subdomains, &pinned, &enabled, &expiresAt, &h.Notes)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Host{}, ErrHostNotFound
+	}
+	if err != nil {
+		return Host{}, err
+	}
+
+	if err := json.Unmarshal([]byte(ips), &h.IPs); err != nil {
+		return Host{}, fmt.Errorf("host %s: invalid ips: %w", h.Domain, err)
+	}
+	if err := json.Unmarshal([]byte(subdomains), &h.Subdomains); err != nil {
+		return Host{}, fmt.Errorf("host %s: invalid subdomains: %w", h.Domain, err)
+	}
+	if len(h.Subdomains) == 0 {
+		h.Subdomains = nil
+	}
+	h.Pinned = pinned
+	h.Enabled = enabled
+
+	if expiresAt.Valid {
+		t, err := time.Parse(time.RFC3339Nano, expiresAt.String)
+		if err != nil {
+			return Host{}, fmt.Errorf("host %s: invalid expires_at: %w", h.Domain, err)
+		}
+		h.ExpiresAt = &t
+	}
+
+	return h, nil
+}
+
+func upsertHost(tx *sql.Tx, h Host) error {
+	ips, err := json.Marshal(h.IPs)
+	if err != nil {
+		return err
+	}
+
+	subdomains := []byte("[]")
+	if len(h.Subdomains) > 0 {
+		if subdomains, err = json.Marshal(h.Subdomains); err != nil {
+			return err
+		}
+	}
+
+	var expiresAt sql.NullString
+	if h.ExpiresAt != nil {
+		expiresAt = sql.NullString{String: h.ExpiresAt.Format(time.RFC3339Nano), Valid: true}
+	}
+
+	_, err = tx.Exec(`INSERT INTO hosts (`+hostColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(domain) DO UPDATE SET
+			ip = excluded.ip, ips = excluded.ips, type = excluded.type,
+			subdomains = excluded.subdomains, pinned = excluded.pinned,
+			enabled = excluded.enabled, expires_at = excluded.expires_at, notes = excluded.notes`,
+		h.Domain, h.IP, string(ips), h.Type, string(subdomains), h.Pinned, h.Enabled, expiresAt, h.Notes)
+	return err
+}
@@ -0,0 +1,479 @@
+package host
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"hostMgr/hostsync"
+	"hostMgr/internal/audit"
+	"hostMgr/internal/extSvc"
+	"hostMgr/internal/opt"
+)
+
+// csvHeader lists the CSV columns used by export; import maps columns by name.
+var csvHeader = []string{"domain", "ips", "type", "subdomains", "pinned", "enabled", "expires_at", "notes"}
+
+// importRecord is a host parsed from import data together with its origin.
+type importRecord struct {
+	line    int
+	content string
+	host    Host
+	raw     bool // plain "<ip> <domain>" line without a type annotation
+}
+
+// reservedHostnames are the system names found in every /etc/hosts, which
+// must never be handed to opt rotation.
+var reservedHostnames = map[string]bool{
+	"localhost":             true,
+	"localhost.localdomain": true,
+	"broadcasthost":         true,
+	"ip6-localhost":         true,
+	"ip6-loopback":          true,
+	"ip6-localnet":          true,
+	"ip6-mcastprefix":       true,
+	"ip6-allnodes":          true,
+	"ip6-allrouters":        true,
+	"ip6-allhosts":          true,
+}
+
+// ExportHosts renders all hosts in the given format.
+func (s *Service) ExportHosts(format string) (HostExport, error) {
+	hosts, err := s.repo.List()
+	if err != nil {
+		return HostExport{}, err
+	}
+
+	switch normalizeFormat(format) {
+	case FormatJSON:
+		payload, err := json.MarshalIndent(hosts, "", "  ")
+		if err != nil {
+			return HostExport{}, err
+		}
+		return HostExport{Content: payload, ContentType: "application/json", Filename: "hosts.json"}, nil
+
+	case FormatHosts:
+		entries := make([]hostsync.HostEntry, 0, len(hosts))
+		for _, h := range hosts {
+			entries = append(entries, toEntry(h))
+		}
+		lines := hostsync.RenderEntries(entries, time.Now())
+		return HostExport{Content: []byte(strings.Join(lines, "\n") + "\n"), ContentType: "text/plain; charset=utf-8", Filename: "hosts.txt"}, nil
+
+	case FormatCSV:
+		var buf bytes.Buffer
+		w := csv.NewWriter(&buf)
+		if err := w.Write(csvHeader); err != nil {
+			return HostExport{}, err
+		}
+		for _, h := range hosts {
+			expiresAt := ""
+			if h.ExpiresAt != nil {
+				expiresAt = h.ExpiresAt.Format(time.RFC3339)
+			}
+			record := []string{
+				h.Domain,
+				strings.Join(h.IPs, ";"),
+				h.Type,
+				strings.Join(h.Subdomains, ";"),
+				strconv.FormatBool(h.Pinned),
+				strconv.FormatBool(h.Enabled),
+				expiresAt,
+				h.Notes,
+			}
+			if err := w.Write(record); err != nil {
+				return HostExport{}, err
+			}
+		}
+		w.Flush()
+		if err := w.Error(); err != nil {
+			return HostExport{}, err
+		}
+		return HostExport{Content: buf.Bytes(), ContentType: "text/csv; charset=utf-8", Filename: "hosts.csv"}, nil
+
+	default:
+		return HostExport{}, fmt.Errorf("invalid format %s, supported: json, hosts, csv", format)
+	}
+}
+
+// ImportHosts parses data in the given format and stores the valid records in
+// a single write, then syncs once. Invalid records are reported per line and
+// do not prevent the others from being imported.
+func (s *Service) ImportHosts(data []byte, format, mode string, cause audit.Cause) (ImportResult, error) {
+	replace := false
+	switch strings.ToLower(strings.TrimSpace(mode)) {
+	case "", "merge":
+	case "replace":
+		replace = true
+	default:
+		return ImportResult{}, fmt.Errorf("invalid mode %s, supported: merge, replace", mode)
+	}
+
+	var records []importRecord
+	var lineErrors []hostsync.LineError
+	var err error
+
+	switch normalizeFormat(format) {
+	case FormatJSON:
+		records, lineErrors, err = parseJSONImport(data)
+	case FormatHosts:
+		records, lineErrors = parseHostsImport(data)
+	case FormatCSV:
+		records, lineErrors, err = parseCSVImport(data)
+	default:
+		return ImportResult{}, fmt.Errorf("invalid format %s, supported: json, hosts, csv", format)
+	}
+	if err != nil {
+		return ImportResult{}, err
+	}
+
+	optSvc, ok := extSvc.OptService.(*opt.Service)
+	if !ok || optSvc == nil {
+		return ImportResult{}, errors.New("opt service not initialized")
+	}
+
+	// 记录已被占用的具体域名，用于检测与现有条目或同批次条目的冲突
+	imported := make(map[string]bool)
+	for _, rec := range records {
+		imported[normalizeDomain(rec.host.Domain)] = true
+	}
+	covered := make(map[string]string)
+	if !replace {
+		hosts, err := s.repo.List()
+		if err != nil {
+			return ImportResult{}, err
+		}
+		for _, h := range hosts {
+			if imported[h.Domain] {
+				continue
+			}
+			for _, d := range h.Domains() {
+				covered[d] = h.Domain
+			}
+		}
+	}
+
+	available := optSvc.GetAllTypes()
+	sort.Strings(available)
+
+	accepted := make([]Host, 0, len(records))
+	seen := make(map[string]bool)
+	now := time.Now()
+	for _, rec := range records {
+		h, err := s.prepareImport(optSvc, available, rec, now)
+		if err == nil && seen[h.Domain] {
+			err = fmt.Errorf("duplicate domain %s in import", h.Domain)
+		}
+		if err == nil {
+			for _, d := range h.Domains() {
+				if owner, ok := covered[d]; ok {
+					err = fmt.Errorf("domain %s is already managed by %s", d, owner)
+					break
+				}
+			}
+		}
+		if err != nil {
+			lineErrors = append(lineErrors, hostsync.LineError{Line: rec.line, Content: rec.content, Reason: err.Error()})
+			continue
+		}
+
+		seen[h.Domain] = true
+		for _, d := range h.Domains() {
+			covered[d] = h.Domain
+		}
+		accepted = append(accepted, h)
+	}
+
+	result := ImportResult{
+		Imported: len(accepted),
+		Failed:   len(lineErrors),
+		Errors:   lineErrors,
+	}
+	if result.Errors == nil {
+		result.Errors = []hostsync.LineError{}
+	}
+
+	if len(accepted) == 0 && !replace {
+		return result, nil
+	}
+
+	if err := s.repo.Import(accepted, replace); err != nil {
+		return ImportResult{}, err
+	}
+
+	domains := make([]string, 0, len(accepted))
+	for _, h := range accepted {
+		domains = append(domains, h.Domain)
+	}
+	cause = cause.Or("bulk import")
+	s.audit.Record(cause, audit.ActionHostImport, "hosts", nil, map[string]interface{}{
+		"format":  normalizeFormat(format),
+		"replace": replace,
+		"domains": domains,
+	})
+	s.revisions.Capture(cause)
+
+	// 同步到系统 hosts 文件
+	if err := s.syncer.Sync(); err != nil {
+		log.Printf("Warning: failed to sync hosts to system: %v", err)
+	}
+
+	return result, nil
+}
+
+// prepareImport validates and completes an imported host. Missing types are
+// detected from the imported IPs, missing IPs are taken from the opt list.
+// Raw hosts lines the detector cannot classify are pinned to their IPs so opt
+// rotation never replaces addresses that were not CDN addresses.
+func (s *Service) prepareImport(optSvc *opt.Service, available []string, rec importRecord, now time.Time) (Host, error) {
+	h := rec.host
+	h.Domain = normalizeDomain(h.Domain)
+	if h.Domain == "" {
+		return Host{}, errors.New("domain is required")
+	}
+	if err := validateDomain(h.Domain); err != nil {
+		return Host{}, err
+	}
+	if reservedHostnames[h.Domain] || strings.HasSuffix(h.Domain, ".localhost") {
+		return Host{}, fmt.Errorf("%s is a reserved system name", h.Domain)
+	}
+
+	subdomains, err := normalizeSubdomains(h.Domain, h.Subdomains)
+	if err != nil {
+		return Host{}, err
+	}
+	h.Subdomains = subdomains
+
+	if len(h.IPs) == 0 && h.IP != "" {
+		h.IPs = []string{h.IP}
+	}
+	ips, err := normalizeIPs(nil, h.IPs)
+	if err != nil {
+		return Host{}, err
+	}
+	for _, ip := range ips {
+		if isReservedIP(ip) {
+			return Host{}, fmt.Errorf("%s is a loopback, unspecified, broadcast or multicast address", ip)
+		}
+	}
+
+	h.Type = strings.TrimSpace(h.Type)
+	if h.Type != "" {
+		if !containsString(available, h.Type) {
+			return Host{}, fmt.Errorf("invalid type %s, available types: [%s]", h.Type, strings.Join(available, ", "))
+		}
+	} else {
+		if s.detector != nil {
+			h.Type, _ = s.detector.Detect(ips)
+		}
+		if h.Type == "" {
+			if rec.raw && len(ips) > 0 {
+				h.Pinned = true
+			}
+			h.Type = s.defaultType
+		}
+		if h.Type == "" {
+			return Host{}, errors.New("type is required")
+		}
+		if !containsString(available, h.Type) {
+			return Host{}, fmt.Errorf("no opt data for type %s, available types: [%s]", h.Type, strings.Join(available, ", "))
+		}
+	}
+
+	if len(ips) == 0 {
+		ips, err = s.candidateIPs(optSvc, h.Type)
+		if err != nil {
+			return Host{}, fmt.Errorf("no ip given and no opt data for type %s: %w", h.Type, err)
+		}
+	}
+	h.IPs = ips
+	h.IP = ips[0]
+
+	if h.Expired(now) {
+		return Host{}, fmt.Errorf("already expired at %s", h.ExpiresAt.Format(time.RFC3339))
+	}
+
+	return h, nil
+}
+
+// parseJSONImport parses a hosts.json style array; errors refer to entry indexes.
+func parseJSONImport(data []byte) ([]importRecord, []hostsync.LineError, error) {
+	var raws []json.RawMessage
+	if err := json.Unmarshal(data, &raws); err != nil {
+		return nil, nil, fmt.Errorf("invalid JSON: expected an array of hosts: %w", err)
+	}
+
+	records := make([]importRecord, 0, len(raws))
+	var lineErrors []hostsync.LineError
+	for i, raw := range raws {
+		var h Host
+		if err := json.Unmarshal(raw, &h); err != nil {
+			lineErrors = append(lineErrors, hostsync.LineError{Line: i + 1, Content: string(raw), Reason: err.Error()})
+			continue
+		}
+		records = append(records, importRecord{line: i + 1, content: string(raw), host: h})
+	}
+
+	return records, lineErrors, nil
+}
+
+// parseHostsImport parses hosts file lines, including raw /etc/hosts snippets.
+func parseHostsImport(data []byte) ([]importRecord, []hostsync.LineError) {
+	entries, lineErrors := hostsync.ParseHostsText(string(data))
+
+	records := make([]importRecord, 0, len(entries))
+	for _, entry := range entries {
+		records = append(records, importRecord{
+			line:    entry.Line,
+			content: fmt.Sprintf("%s %s", strings.Join(entry.IPs, ","), entry.Domain),
+			host: Host{
+				Domain:  entry.Domain,
+				IPs:     entry.IPs,
+				Type:    entry.Type,
+				Enabled: true,
+			},
+			raw: entry.Type == "",
+		})
+	}
+
+	return records, lineErrors
+}
+
+// parseCSVImport parses CSV with a header row; columns are matched by name and
+// list columns (ips, subdomains) are separated by semicolons.
+func parseCSVImport(data []byte) ([]importRecord, []hostsync.LineError, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+
+	header, err := r.Read()
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid CSV: missing header: %w", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["domain"]; !ok {
+		return nil, nil, errors.New("invalid CSV: header must contain a domain column")
+	}
+
+	var records []importRecord
+	var lineErrors []hostsync.LineError
+	for {
+		row, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		line, _ := r.FieldPos(0)
+		if err != nil {
+			lineErrors = append(lineErrors, hostsync.LineError{Line: line, Reason: err.Error()})
+			continue
+		}
+
+		content := strings.Join(row, ",")
+		h, err := csvRowToHost(row, columns)
+		if err != nil {
+			lineErrors = append(lineErrors, hostsync.LineError{Line: line, Content: content, Reason: err.Error()})
+			continue
+		}
+		records = append(records, importRecord{line: line, content: content, host: h})
+	}
+
+	return records, lineErrors, nil
+}
+
+func csvRowToHost(row []string, columns map[string]int) (Host, error) {
+	get := func(name string) string {
+		if i, ok := columns[name]; ok && i < len(row) {
+			return strings.TrimSpace(row[i])
+		}
+		return ""
+	}
+
+	h := Host{
+		Domain:     get("domain"),
+		IPs:        splitList(get("ips")),
+		Type:       get("type"),
+		Subdomains: splitList(get("subdomains")),
+		Enabled:    true,
+		Notes:      get("notes"),
+	}
+
+	if v := get("pinned"); v != "" {
+		pinned, err := strconv.ParseBool(v)
+		if err != nil {
+			return Host{}, fmt.Errorf("invalid pinned %q", v)
+		}
+		h.Pinned = pinned
+	}
+	if v := get("enabled"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return Host{}, fmt.Errorf("invalid enabled %q", v)
+		}
+		h.Enabled = enabled
+	}
+	if v := get("expires_at"); v != "" {
+		expiresAt, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return Host{}, fmt.Errorf("invalid expires_at %q", v)
+		}
+		h.ExpiresAt = &expiresAt
+	}
+
+	return h, nil
+}
+
+// isReservedIP reports whether ip is an address that only makes sense for the
+// local machine or the local link, never for a CDN host.
+func isReservedIP(value string) bool {
+	ip := net.ParseIP(value)
+	if ip == nil {
+		return false
+	}
+	return ip.IsLoopback() || ip.IsUnspecified() || ip.IsMulticast() || ip.Equal(net.IPv4bcast)
+}
+
+func splitList(value string) []string {
+	if value == "" {
+		return nil
+	}
+	var result []string
+	for _, item := range strings.Split(value, ";") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+func normalizeFormat(format string) string {
+	format = strings.ToLower(strings.TrimSpace(format))
+	if format == "" {
+		return FormatJSON
+	}
+	return format
+}
+
+// toEntry converts a host into the entry shape used by hostsync.
+func toEntry(h Host) hostsync.HostEntry {
+	return hostsync.HostEntry{
+		Domain:     h.Domain,
+		IP:         h.IP,
+		IPs:        h.IPs,
+		Type:       h.Type,
+		Subdomains: h.Subdomains,
+		Enabled:    h.Enabled,
+		ExpiresAt:  h.ExpiresAt,
+	}
+}
@@ -0,0 +1,219 @@
+package opt
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OptStatus 优选数据的新鲜度与存量
+type OptStatus struct {
+	Type        string     `json:"type"`
+	Size        int        `json:"size"` // 优选池中的 IP 数量
+	Current     *OptInfo   `json:"current,omitempty"`
+	ReportedAt  *time.Time `json:"reported_at,omitempty"` // 最近一次上报时间, 未知时省略
+	Age         *int64     `json:"age,omitempty"`         // 距最近一次上报的秒数
+	Quarantined int        `json:"quarantined"`           // 隔离中的 IP 数量
+	Stale       bool       `json:"stale"`                 // 超过 max_age 未上报(上报时间未知也视为过期)
+	LowPool     bool       `json:"low_pool"`              // IP 数量低于 min_pool
+	// ReoptimizedAt 最近一次请求重新优选的时间
+	ReoptimizedAt *time.Time `json:"reoptimized_at,omitempty"`
+}
+
+// NeedsReoptimize 判断是否需要重新优选
+func (st OptStatus) NeedsReoptimize() bool {
+	return st.Stale || st.LowPool
+}
+
+// reason 描述需要重新优选的原因
+func (st OptStatus) reason() string {
+	reasons := make([]string, 0, 2)
+	if st.Stale {
+		if st.Age != nil {
+			reasons = append(reasons, fmt.Sprintf("opt data is %s old", (time.Duration(*st.Age)*time.Second).String()))
+		} else {
+			reasons = append(reasons, "opt data has no report time")
+		}
+	}
+	if st.LowPool {
+		reasons = append(reasons, fmt.Sprintf("only %d IP(s) left", st.Size))
+	}
+	return strings.Join(reasons, ", ")
+}
+
+// StatusResponse 优选状态响应
+type StatusResponse struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    []OptStatus `json:"data"`
+}
+
+// reportedAt 返回最近一次上报时间, 早期数据退化为最新的测速时间
+func (d *OptData) reportedAt() *time.Time {
+	if d.ReportedAt != nil {
+		return d.ReportedAt
+	}
+
+	var latest *time.Time
+	for i := range d.Data {
+		if t := d.Data[i].TestedAt; t != nil && (latest == nil || t.After(*latest)) {
+			latest = t
+		}
+	}
+	return latest
+}
+
+// SetFreshness 设置优选数据的最大有效期与最少 IP 数量, 0 表示不检查
+func (s *Service) SetFreshness(maxAge time.Duration, minPool int) {
+	s.maxAge = maxAge
+	s.minPool = minPool
+}
+
+// SetReoptimizer 设置重新优选触发器, 为 nil 时只标记状态不触发
+func (s *Service) SetReoptimizer(r *Reoptimizer) {
+	s.reoptimizer = r
+}
+
+// GetStatus 返回各类型优选数据的状态, optType 为空时返回所有类型
+func (s *Service) GetStatus(optType string) ([]OptStatus, error) {
+	data, err := s.repo.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	if optType != "" {
+		optData, ok := data[optType]
+		if !ok {
+			return nil, ErrNoOptDataFound
+		}
+		data = map[string]OptData{optType: optData}
+	}
+
+	quarantine, err := s.repo.ListQuarantine(optType)
+	if err != nil {
+		return nil, err
+	}
+	quarantined := make(map[string]int)
+	for _, e := range quarantine {
+		quarantined[e.Type]++
+	}
+
+	now := time.Now()
+	result := make([]OptStatus, 0, len(data))
+	for t, optData := range data {
+		st := OptStatus{
+			Type:        t,
+			Size:        len(optData.Data),
+			ReportedAt:  optData.reportedAt(),
+			Quarantined: quarantined[t],
+		}
+		if optData.Current < len(optData.Data) {
+			current := optData.Data[optData.Current]
+			st.Current = &current
+		}
+		if st.ReportedAt != nil {
+			age := int64(now.Sub(*st.ReportedAt).Seconds())
+			st.Age = &age
+		}
+		st.Stale = s.maxAge > 0 && (st.ReportedAt == nil || now.Sub(*st.ReportedAt) > s.maxAge)
+		st.LowPool = st.Size < s.minPool
+		if last, ok := s.reoptimizer.LastTriggered(t); ok {
+			st.ReoptimizedAt = &last
+		}
+		result = append(result, st)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Type < result[j].Type
+	})
+	return result, nil
+}
+
+// Reoptimize 请求重新优选; force 为 true 时忽略冷却时间
+func (s *Service) Reoptimize(optType, reason string, force bool) error {
+	return s.reoptimizer.Trigger(optType, reason, force)
+}
+
+// FreshnessMonitor 定期检查优选数据, 过期或存量不足时记录日志并请求重新优选
+type FreshnessMonitor struct {
+	svc      *Service
+	interval time.Duration
+	stop     chan struct{}
+	once     sync.Once
+	flagged  map[string]bool // 上次检查时已标记的类型, 避免重复打印日志
+}
+
+// NewFreshnessMonitor 创建绑定到 opt service 的新鲜度检查
+func NewFreshnessMonitor(svc *Service, interval time.Duration) *FreshnessMonitor {
+	if interval <= 0 {
+		interval = 10 * time.Minute
+	}
+
+	return &FreshnessMonitor{
+		svc:      svc,
+		interval: interval,
+		stop:     make(chan struct{}),
+		flagged:  make(map[string]bool),
+	}
+}
+
+// Start 在后台运行检查循环, 启动时立即检查一次
+func (m *FreshnessMonitor) Start() {
+	go func() {
+		m.CheckOnce()
+
+		ticker := time.NewTicker(m.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				m.CheckOnce()
+			case <-m.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop 结束检查循环
+func (m *FreshnessMonitor) Stop() {
+	m.once.Do(func() {
+		close(m.stop)
+	})
+}
+
+// CheckOnce 检查所有类型一次, 返回触发重新优选的类型数量
+func (m *FreshnessMonitor) CheckOnce() int {
+	statuses, err := m.svc.GetStatus("")
+	if err != nil {
+		log.Printf("Warning: opt freshness check skipped: %v", err)
+		return 0
+	}
+
+	triggered := 0
+	for _, st := range statuses {
+		if !st.NeedsReoptimize() {
+			if m.flagged[st.Type] {
+				log.Printf("Opt data is healthy again (type=%s)", st.Type)
+				delete(m.flagged, st.Type)
+			}
+			continue
+		}
+
+		reason := st.reason()
+		if !m.flagged[st.Type] {
+			log.Printf("Warning: opt data needs re-optimization (type=%s): %s", st.Type, reason)
+			m.flagged[st.Type] = true
+		}
+
+		// 冷却期内或正在运行时不重复触发
+		if err := m.svc.Reoptimize(st.Type, reason, false); err == nil {
+			triggered++
+		}
+	}
+
+	return triggered
+}
@@ -0,0 +1,185 @@
+package opt
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"hostMgr/internal/store"
+)
+
+// OptReport 一次优选上报的历史记录
+type OptReport struct {
+	ID       int64     `json:"id"`
+	Time     time.Time `json:"time"`
+	Type     string    `json:"type"`
+	Reporter string    `json:"reporter"` // 上报方标识, 未提供时为客户端地址
+	Data     []OptInfo `json:"data"`
+}
+
+// HistoryQuery 上报历史查询条件, 零值表示不过滤
+type HistoryQuery struct {
+	Type  string    `form:"type"`
+	Since time.Time `form:"since" time_format:"2006-01-02T15:04:05Z07:00"`
+	Until time.Time `form:"until" time_format:"2006-01-02T15:04:05Z07:00"`
+	Limit int       `form:"limit"` // 只返回最新的 Limit 条, 0 表示不限制
+}
+
+// match 判断记录是否满足查询条件
+func (q HistoryQuery) match(r OptReport) bool {
+	if q.Type != "" && r.Type != q.Type {
+		return false
+	}
+	if !q.Since.IsZero() && r.Time.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && r.Time.After(q.Until) {
+		return false
+	}
+	return true
+}
+
+// HistoryStore 上报历史存储
+type HistoryStore interface {
+	// Append 追加一条上报记录并分配 ID
+	Append(r *OptReport) error
+	// Query 按时间先后返回符合条件的记录
+	Query(q HistoryQuery) ([]OptReport, error)
+	// Prune 删除 before 之前的记录, 返回删除数量
+	Prune(before time.Time) (int, error)
+}
+
+// FileHistoryStore 以 JSON Lines 文件保存上报历史
+type FileHistoryStore struct {
+	file   *store.JSONLFile
+	mu     sync.Mutex
+	nextID int64
+	oldest time.Time // 最早一条记录的时间, 未过期时 Prune 无需读取文件; 无记录时为零值
+}
+
+// NewFileHistoryStore 打开上报历史文件, 目录不存在时自动创建
+func NewFileHistoryStore(path string) (*FileHistoryStore, error) {
+	file, err := store.OpenJSONL(path)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &FileHistoryStore{file: file, nextID: 1}
+	reports, skipped, err := s.readAll()
+	if err != nil {
+		return nil, err
+	}
+	if skipped > 0 {
+		log.Printf("Warning: skipped %d malformed line(s) in opt history %s", skipped, path)
+	}
+	for _, r := range reports {
+		if r.ID >= s.nextID {
+			s.nextID = r.ID + 1
+		}
+		if s.oldest.IsZero() || r.Time.Before(s.oldest) {
+			s.oldest = r.Time
+		}
+	}
+
+	return s, nil
+}
+
+// Append 追加一条上报记录
+func (s *FileHistoryStore) Append(r *OptReport) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r.ID = s.nextID
+	if err := s.file.Append(r); err != nil {
+		return err
+	}
+
+	s.nextID++
+	if s.oldest.IsZero() || r.Time.Before(s.oldest) {
+		s.oldest = r.Time
+	}
+	return nil
+}
+
+// Query 按时间先后返回符合条件的记录
+func (s *FileHistoryStore) Query(q HistoryQuery) ([]OptReport, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reports, _, err := s.readAll()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]OptReport, 0)
+	for _, r := range reports {
+		if q.match(r) {
+			result = append(result, r)
+		}
+	}
+
+	if q.Limit > 0 && len(result) > q.Limit {
+		result = result[len(result)-q.Limit:]
+	}
+
+	return result, nil
+}
+
+// Prune 删除 before 之前的记录, 有记录被删除时重写整个文件.
+// 最早的记录尚未过期时直接返回, 不读取文件
+func (s *FileHistoryStore) Prune(before time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.oldest.IsZero() || !s.oldest.Before(before) {
+		return 0, nil
+	}
+
+	reports, _, err := s.readAll()
+	if err != nil {
+		return 0, err
+	}
+
+	var oldest time.Time
+	kept := make([]OptReport, 0, len(reports))
+	for _, r := range reports {
+		if !r.Time.Before(before) {
+			kept = append(kept, r)
+			if oldest.IsZero() || r.Time.Before(oldest) {
+				oldest = r.Time
+			}
+		}
+	}
+
+	removed := len(reports) - len(kept)
+	if removed == 0 {
+		s.oldest = oldest
+		return 0, nil
+	}
+
+	if err := s.file.Rewrite(len(kept), func(i int) interface{} { return kept[i] }); err != nil {
+		return 0, err
+	}
+	s.oldest = oldest
+
+	return removed, nil
+}
+
+// readAll 读取全部记录, 文件不存在时返回空列表.
+// 无法解析的行 (如崩溃或磁盘写满时未写完的记录) 被跳过并计数, 下次清理重写文件时丢弃
+func (s *FileHistoryStore) readAll() ([]OptReport, int, error) {
+	reports := make([]OptReport, 0)
+	skipped, err := s.file.Scan(func(line []byte) error {
+		var r OptReport
+		if err := json.Unmarshal(line, &r); err != nil {
+			return err
+		}
+		reports = append(reports, r)
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return reports, skipped, nil
+}
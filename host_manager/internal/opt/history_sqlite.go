@@ -0,0 +1,129 @@
+package opt
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// SQLiteHistoryStore 以 SQLite 的 opt_history 表保存上报历史
+type SQLiteHistoryStore struct {
+	db *sql.DB
+}
+
+var (
+	_ HistoryStore = (*FileHistoryStore)(nil)
+	_ HistoryStore = (*SQLiteHistoryStore)(nil)
+)
+
+// NewSQLiteHistoryStore 创建 opt_history 表(如不存在)
+func NewSQLiteHistoryStore(db *sql.DB) (*SQLiteHistoryStore, error) {
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS opt_history (
+		id       INTEGER PRIMARY KEY AUTOINCREMENT,
+		time     INTEGER NOT NULL,
+		type     TEXT NOT NULL,
+		reporter TEXT NOT NULL DEFAULT '',
+		data     TEXT NOT NULL
+	)`); err != nil {
+		return nil, fmt.Errorf("create opt_history table: %w", err)
+	}
+
+	if _, err := db.Exec(`CREATE INDEX IF NOT EXISTS idx_opt_history_type_time ON opt_history (type, time)`); err != nil {
+		return nil, fmt.Errorf("create opt_history index: %w", err)
+	}
+
+	return &SQLiteHistoryStore{db: db}, nil
+}
+
+// Append 追加一条上报记录, 时间以 Unix 纳秒保存
+func (s *SQLiteHistoryStore) Append(r *OptReport) error {
+	data, err := json.Marshal(r.Data)
+	if err != nil {
+		return err
+	}
+
+	res, err := s.db.Exec(`INSERT INTO opt_history (time, type, reporter, data) VALUES (?, ?, ?, ?)`,
+		r.Time.UnixNano(), r.Type, r.Reporter, string(data))
+	if err != nil {
+		return err
+	}
+
+	r.ID, err = res.LastInsertId()
+	return err
+}
+
+// Query 按时间先后返回符合条件的记录
+func (s *SQLiteHistoryStore) Query(q HistoryQuery) ([]OptReport, error) {
+	var (
+		where []string
+		args  []interface{}
+	)
+	if q.Type != "" {
+		where = append(where, "type = ?")
+		args = append(args, q.Type)
+	}
+	if !q.Since.IsZero() {
+		where = append(where, "time >= ?")
+		args = append(args, q.Since.UnixNano())
+	}
+	if !q.Until.IsZero() {
+		where = append(where, "time <= ?")
+		args = append(args, q.Until.UnixNano())
+	}
+
+	query := `SELECT id, time, type, reporter, data FROM opt_history`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	// 取最新的 Limit 条后再按时间正序返回
+	query += " ORDER BY id DESC"
+	if q.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, q.Limit)
+	}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]OptReport, 0)
+	for rows.Next() {
+		var (
+			r     OptReport
+			nanos int64
+			data  string
+		)
+		if err := rows.Scan(&r.ID, &nanos, &r.Type, &r.Reporter, &data); err != nil {
+			return nil, err
+		}
+		r.Time = time.Unix(0, nanos)
+		if err := json.Unmarshal([]byte(data), &r.Data); err != nil {
+			return nil, fmt.Errorf("opt report %d: %w", r.ID, err)
+		}
+		result = append(result, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i, j := 0, len(result)-1; i < j; i, j = i+1, j-1 {
+		result[i], result[j] = result[j], result[i]
+	}
+
+	return result, nil
+}
+
+// Prune 删除 before 之前的记录
+func (s *SQLiteHistoryStore) Prune(before time.Time) (int, error) {
+	res, err := s.db.Exec(`DELETE FROM opt_history WHERE time < ?`, before.UnixNano())
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := res.RowsAffected()
+	return int(n), err
+}
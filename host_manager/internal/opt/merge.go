@@ -0,0 +1,103 @@
+package opt
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// 上报模式
+const (
+	ReportModeReplace = "replace" // 上报的列表整体替换该类型的优选池
+	ReportModeMerge   = "merge"   // 与现有优选池合并去重后按评分排序
+)
+
+// ScoreWeights 合并模式下的评分权重, 分数越高越优先
+//
+//	score = Speed*速度(MB/s) - Delay*延迟(ms) - Loss*丢包率(%) - Age*测速距今(小时)
+type ScoreWeights struct {
+	Delay float64
+	Speed float64
+	Loss  float64
+	Age   float64
+}
+
+// Score 计算 info 在 now 时的评分, 没有测速时间的按 0 小时计
+func (w ScoreWeights) Score(info OptInfo, now time.Time) float64 {
+	var ageHours float64
+	if info.TestedAt != nil {
+		ageHours = now.Sub(*info.TestedAt).Hours()
+	}
+	return w.Speed*info.Speed - w.Delay*info.Delay - w.Loss*info.LossRate*100 - w.Age*ageHours
+}
+
+// MergeOptions 上报模式与合并参数
+type MergeOptions struct {
+	DefaultMode string        // 上报请求未指定 mode 时使用
+	Weights     ScoreWeights  // 合并后排序使用的评分权重
+	EntryMaxAge time.Duration // 测速时间超过该时长的 IP 在合并时被淘汰, 0 表示不淘汰
+	MaxPool     int           // 合并后保留的最多 IP 数量, 0 表示不限制
+}
+
+// SetMergeOptions 设置上报模式与合并参数
+func (s *Service) SetMergeOptions(opts MergeOptions) {
+	s.merge = opts
+}
+
+// reportMode 返回上报请求实际使用的模式
+func (s *Service) reportMode(mode string) (string, error) {
+	if mode == "" {
+		mode = s.merge.DefaultMode
+	}
+	switch mode {
+	case "", ReportModeReplace:
+		return ReportModeReplace, nil
+	case ReportModeMerge:
+		return ReportModeMerge, nil
+	default:
+		return "", fmt.Errorf("unsupported report mode %q", mode)
+	}
+}
+
+// mergeOptData 合并现有优选池与上报的 IP: 同一 IP 保留测速时间较新的一条,
+// 淘汰测速时间过旧的 IP, 再按评分从高到低排序并截断到 MaxPool
+func mergeOptData(existing, incoming []OptInfo, opts MergeOptions, now time.Time) []OptInfo {
+	byIP := make(map[string]OptInfo, len(existing)+len(incoming))
+	for _, list := range [][]OptInfo{existing, incoming} {
+		for _, info := range list {
+			if prev, ok := byIP[info.IP]; ok && newerTest(prev, info) {
+				continue
+			}
+			byIP[info.IP] = info
+		}
+	}
+
+	merged := make([]OptInfo, 0, len(byIP))
+	for _, info := range byIP {
+		if opts.EntryMaxAge > 0 && (info.TestedAt == nil || now.Sub(*info.TestedAt) > opts.EntryMaxAge) {
+			continue
+		}
+		merged = append(merged, info)
+	}
+
+	sort.SliceStable(merged, func(i, j int) bool {
+		si, sj := opts.Weights.Score(merged[i], now), opts.Weights.Score(merged[j], now)
+		if si != sj {
+			return si > sj
+		}
+		return merged[i].IP < merged[j].IP
+	})
+
+	if opts.MaxPool > 0 && len(merged) > opts.MaxPool {
+		merged = merged[:opts.MaxPool]
+	}
+	return merged
+}
+
+// newerTest 判断 a 的测速时间是否晚于 b
+func newerTest(a, b OptInfo) bool {
+	if a.TestedAt == nil {
+		return false
+	}
+	return b.TestedAt == nil || a.TestedAt.After(*b.TestedAt)
+}
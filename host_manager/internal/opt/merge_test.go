@@ -0,0 +1,163 @@
+package opt
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"hostMgr/internal/store"
+)
+
+func testedAt(now time.Time, ago time.Duration) *time.Time {
+	t := now.Add(-ago)
+	return &t
+}
+
+func ips(list []OptInfo) []string {
+	result := make([]string, len(list))
+	for i, info := range list {
+		result[i] = info.IP
+	}
+	return result
+}
+
+func TestMergeOptData(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	weights := ScoreWeights{Delay: 1, Speed: 10}
+
+	tests := []struct {
+		name     string
+		existing []OptInfo
+		incoming []OptInfo
+		opts     MergeOptions
+		want     []string
+	}{
+		{
+			name:     "sorted by score",
+			existing: []OptInfo{{IP: "1.1.1.1", Delay: 100, Speed: 5, TestedAt: &now}},
+			incoming: []OptInfo{{IP: "2.2.2.2", Delay: 50, Speed: 5, TestedAt: &now}},
+			opts:     MergeOptions{Weights: weights},
+			want:     []string{"2.2.2.2", "1.1.1.1"},
+		},
+		{
+			name:     "same ip keeps the newer test",
+			existing: []OptInfo{{IP: "1.1.1.1", Delay: 10, TestedAt: testedAt(now, time.Hour)}, {IP: "2.2.2.2", Delay: 50, TestedAt: &now}},
+			incoming: []OptInfo{{IP: "1.1.1.1", Delay: 100, TestedAt: &now}},
+			opts:     MergeOptions{Weights: weights},
+			want:     []string{"2.2.2.2", "1.1.1.1"},
+		},
+		{
+			name:     "same ip keeps the existing entry when the report is older",
+			existing: []OptInfo{{IP: "1.1.1.1", Delay: 10, TestedAt: &now}, {IP: "2.2.2.2", Delay: 50, TestedAt: &now}},
+			incoming: []OptInfo{{IP: "1.1.1.1", Delay: 100, TestedAt: testedAt(now, time.Hour)}},
+			opts:     MergeOptions{Weights: weights},
+			want:     []string{"1.1.1.1", "2.2.2.2"},
+		},
+		{
+			name:     "entries tested too long ago are dropped",
+			existing: []OptInfo{{IP: "1.1.1.1", TestedAt: testedAt(now, 48*time.Hour)}, {IP: "3.3.3.3"}},
+			incoming: []OptInfo{{IP: "2.2.2.2", TestedAt: testedAt(now, time.Hour)}},
+			opts:     MergeOptions{Weights: weights, EntryMaxAge: 24 * time.Hour},
+			want:     []string{"2.2.2.2"},
+		},
+		{
+			name:     "truncated to the pool size",
+			existing: []OptInfo{{IP: "1.1.1.1", Speed: 1, TestedAt: &now}, {IP: "2.2.2.2", Speed: 2, TestedAt: &now}},
+			incoming: []OptInfo{{IP: "3.3.3.3", Speed: 3, TestedAt: &now}},
+			opts:     MergeOptions{Weights: weights, MaxPool: 2},
+			want:     []string{"3.3.3.3", "2.2.2.2"},
+		},
+		{
+			name:     "equal scores ordered by ip",
+			incoming: []OptInfo{{IP: "2.2.2.2", TestedAt: &now}, {IP: "1.1.1.1", TestedAt: &now}},
+			opts:     MergeOptions{Weights: weights},
+			want:     []string{"1.1.1.1", "2.2.2.2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ips(mergeOptData(tt.existing, tt.incoming, tt.opts, now))
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Fatalf("merged = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// testConcurrentMerge reports one IP from each of several goroutines and
+// checks that no report is lost.
+func testConcurrentMerge(t *testing.T, repo Repository) {
+	t.Helper()
+
+	const reporters = 16
+	now := time.Now()
+
+	var wg sync.WaitGroup
+	for i := 0; i < reporters; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			incoming := []OptInfo{{IP: fmt.Sprintf("10.0.0.%d", i+1), TestedAt: &now}}
+			if _, _, err := repo.MergeOptData("cloudflare", incoming, MergeOptions{}, now); err != nil {
+				t.Errorf("merge: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if size := repo.GetOptListSize("cloudflare"); size != reporters {
+		t.Fatalf("pool size = %d, want %d", size, reporters)
+	}
+}
+
+func TestFileRepositoryMergeOptDataConcurrent(t *testing.T) {
+	repo, err := NewFileRepository(filepath.Join(t.TempDir(), "opts.json"))
+	if err != nil {
+		t.Fatalf("open repository: %v", err)
+	}
+	testConcurrentMerge(t, repo)
+}
+
+func TestSQLiteRepositoryMergeOptDataConcurrent(t *testing.T) {
+	db, err := store.OpenSQLite(filepath.Join(t.TempDir(), "hostmgr.db"))
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	repo, err := NewSQLiteRepository(db)
+	if err != nil {
+		t.Fatalf("open repository: %v", err)
+	}
+	testConcurrentMerge(t, repo)
+}
+
+func TestMergeOptDataFiltersQuarantined(t *testing.T) {
+	repo, err := NewFileRepository(filepath.Join(t.TempDir(), "opts.json"))
+	if err != nil {
+		t.Fatalf("open repository: %v", err)
+	}
+
+	now := time.Now()
+	if _, err := repo.SaveOptData("cloudflare", []OptInfo{{IP: "1.1.1.1"}, {IP: "2.2.2.2"}}); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	if err := repo.ChangeToNext("cloudflare", &QuarantineEntry{Since: now, Until: now.Add(time.Hour)}); err != nil {
+		t.Fatalf("change: %v", err)
+	}
+
+	incoming := []OptInfo{{IP: "1.1.1.1", TestedAt: &now}, {IP: "3.3.3.3", TestedAt: &now}}
+	before, saved, err := repo.MergeOptData("cloudflare", incoming, MergeOptions{}, now)
+	if err != nil {
+		t.Fatalf("merge: %v", err)
+	}
+	if got := fmt.Sprint(ips(before)); got != "[2.2.2.2]" {
+		t.Fatalf("before = %s, want [2.2.2.2]", got)
+	}
+	if got := fmt.Sprint(ips(saved)); got != "[2.2.2.2 3.3.3.3]" {
+		t.Fatalf("saved = %s, want [2.2.2.2 3.3.3.3]", got)
+	}
+}
@@ -1,10 +1,79 @@
 package opt
 
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
 // OptInfo 优选信息模型
 type OptInfo struct {
-	IP    string `json:"ip" binding:"required"`
-	Delay string `json:"delay" binding:"required"`
-	Rate  string `json:"rate" binding:"required"`
+	IP       string     `json:"ip" binding:"required"`
+	Delay    float64    `json:"delay" binding:"gte=0"`              // 平均延迟(ms)
+	Speed    float64    `json:"speed" binding:"gte=0"`              // 下载速度(MB/s)
+	LossRate float64    `json:"loss_rate" binding:"gte=0,lte=1"`    // 丢包率(0~1)
+	Colo     string     `json:"colo,omitempty"`                     // 测速节点所在地区码, 如 HKG
+	Sent     int        `json:"sent,omitempty" binding:"gte=0"`     // 延迟测试发送次数
+	Received int        `json:"received,omitempty" binding:"gte=0"` // 延迟测试成功次数
+	TestedAt *time.Time `json:"tested_at,omitempty"`                // 测速时间, 上报时未填写则为上报时间
+}
+
+// UnmarshalJSON 兼容旧格式: delay 与 rate(即 speed) 以字符串表示, 如 {"delay":"120","rate":"12.50"}
+func (o *OptInfo) UnmarshalJSON(data []byte) error {
+	type plain OptInfo
+	var decoded struct {
+		plain
+		Delay json.RawMessage `json:"delay"`
+		Speed json.RawMessage `json:"speed"`
+		Rate  json.RawMessage `json:"rate"`
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+
+	info := OptInfo(decoded.plain)
+	var err error
+	if info.Delay, err = parseNumber("delay", decoded.Delay); err != nil {
+		return err
+	}
+	speed := decoded.Speed
+	if len(speed) == 0 {
+		speed = decoded.Rate
+	}
+	if info.Speed, err = parseNumber("speed", speed); err != nil {
+		return err
+	}
+
+	*o = info
+	return nil
+}
+
+// parseNumber 解析数字或数字字符串, 缺省或空字符串为 0
+func parseNumber(field string, raw json.RawMessage) (float64, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return 0, nil
+	}
+
+	var n float64
+	if err := json.Unmarshal(raw, &n); err == nil {
+		return n, nil
+	}
+
+	var str string
+	if err := json.Unmarshal(raw, &str); err != nil {
+		return 0, fmt.Errorf("invalid %s: %s", field, raw)
+	}
+	str = strings.TrimSpace(str)
+	if str == "" {
+		return 0, nil
+	}
+	n, err := strconv.ParseFloat(str, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %q", field, str)
+	}
+	return n, nil
 }
 
 // OptData 优选数据(包含类型和 IP 列表)
@@ -12,17 +81,24 @@ type OptData struct {
 	Type    string    `json:"type"`
 	Data    []OptInfo `json:"data"`
 	Current int       `json:"current"` // 当前使用的优选索引
+	// ReportedAt 最近一次上报的时间, 早期数据没有该字段
+	ReportedAt *time.Time `json:"reported_at,omitempty"`
 }
 
 // OptStore 用于 JSON 文件存储的结构
 type OptStore struct {
-	Opts map[string]*OptData `json:"opts"` // key 为 type
+	Opts       map[string]*OptData          `json:"opts"`                 // key 为 type
+	Quarantine map[string][]QuarantineEntry `json:"quarantine,omitempty"` // key 为 type
 }
 
 // ReportRequest 优选上报请求
 type ReportRequest struct {
 	Type string    `json:"type" binding:"required"`
-	Data []OptInfo `json:"data" binding:"required"`
+	Data []OptInfo `json:"data" binding:"required,dive"`
+	// Reporter 上报方标识(如主机名), 记录到上报历史中
+	Reporter string `json:"reporter,omitempty"`
+	// Mode 上报模式: replace 整体替换, merge 与现有优选池合并; 为空时使用配置的 opt.report_mode
+	Mode string `json:"mode,omitempty"`
 }
 
 // BaseResponse 基础响应
@@ -37,4 +113,13 @@ type GetOptResponse struct {
 	Message string  `json:"message"`
 	Type    string  `json:"type"`
 	Data    OptInfo `json:"data"`
+	// Status 该类型的新鲜度与存量, 过期或存量不足时 stale/low_pool 为 true
+	Status *OptStatus `json:"status,omitempty"`
+}
+
+// HistoryResponse 上报历史响应
+type HistoryResponse struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    []OptReport `json:"data"`
 }
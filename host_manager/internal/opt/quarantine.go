@@ -0,0 +1,82 @@
+package opt
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrAllQuarantined 上报的 IP 全部处于隔离期
+var ErrAllQuarantined = errors.New("all reported IPs are quarantined")
+
+// QuarantineEntry 被更换掉的优选 IP, 冷却期内上报数据中的同一 IP 会被过滤
+type QuarantineEntry struct {
+	Type   string    `json:"type"`
+	IP     string    `json:"ip"`
+	Actor  string    `json:"actor"`  // 触发隔离的操作方, 如 api(手动更换) 或 scheduler(健康检查失败)
+	Reason string    `json:"reason"` // 更换原因
+	Since  time.Time `json:"since"`
+	Until  time.Time `json:"until"` // 冷却期结束时间
+}
+
+// Active 判断 now 时是否仍在冷却期内
+func (e QuarantineEntry) Active(now time.Time) bool {
+	return now.Before(e.Until)
+}
+
+// QuarantineResponse 隔离列表响应
+type QuarantineResponse struct {
+	Code    int               `json:"code"`
+	Message string            `json:"message"`
+	Data    []QuarantineEntry `json:"data"`
+}
+
+// ClearQuarantineResponse 解除隔离响应, Data 为解除的 IP 数量
+type ClearQuarantineResponse struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    int    `json:"data"`
+}
+
+// filterQuarantined 去掉 data 中处于隔离期的 IP
+func filterQuarantined(data []OptInfo, entries []QuarantineEntry, now time.Time) []OptInfo {
+	blocked := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		if e.Active(now) {
+			blocked[e.IP] = true
+		}
+	}
+	if len(blocked) == 0 {
+		return data
+	}
+
+	kept := make([]OptInfo, 0, len(data))
+	for _, info := range data {
+		if !blocked[info.IP] {
+			kept = append(kept, info)
+		}
+	}
+	return kept
+}
+
+// putQuarantine 加入或更新同一 IP 的隔离记录, 并去掉已过期的记录
+func putQuarantine(entries []QuarantineEntry, entry QuarantineEntry, now time.Time) []QuarantineEntry {
+	result := activeQuarantine(entries, now)
+	for i := range result {
+		if result[i].IP == entry.IP {
+			result[i] = entry
+			return result
+		}
+	}
+	return append(result, entry)
+}
+
+// activeQuarantine 返回仍在冷却期内的记录
+func activeQuarantine(entries []QuarantineEntry, now time.Time) []QuarantineEntry {
+	result := make([]QuarantineEntry, 0, len(entries))
+	for _, e := range entries {
+		if e.Active(now) {
+			result = append(result, e)
+		}
+	}
+	return result
+}
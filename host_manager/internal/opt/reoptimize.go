@@ -0,0 +1,179 @@
+package opt
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+var (
+	ErrReoptimizeDisabled = errors.New("no optimizer url or command configured")
+	ErrReoptimizeRunning  = errors.New("optimizer is already running for this type")
+	ErrReoptimizeCooldown = errors.New("optimizer was triggered recently")
+)
+
+// ReoptimizeRequest 调用优选端点时 POST 的请求体
+type ReoptimizeRequest struct {
+	Type   string `json:"type"`
+	Reason string `json:"reason"`
+}
+
+// Reoptimizer 在优选数据过期或存量不足时请求重新优选:
+// 向配置的 URL 发送 POST 请求, 和/或执行配置的命令(如 cf_opt 单次运行)
+type Reoptimizer struct {
+	url      string
+	command  []string
+	cooldown time.Duration // 同一类型两次自动触发的最小间隔
+	timeout  time.Duration // 命令的最长运行时间
+	env      []string      // 传给命令的 host_manager 认证信息
+	client   *http.Client
+
+	mu      sync.Mutex
+	last    map[string]time.Time
+	running map[string]bool
+}
+
+// NewReoptimizer 创建重新优选触发器, url 与 command 都未配置时返回 nil.
+// 命令运行超过 timeout 时被终止
+func NewReoptimizer(url string, command []string, cooldown, timeout time.Duration) *Reoptimizer {
+	if url == "" && len(command) == 0 {
+		return nil
+	}
+	if timeout <= 0 {
+		timeout = 30 * time.Minute
+	}
+
+	return &Reoptimizer{
+		url:      url,
+		command:  command,
+		cooldown: cooldown,
+		timeout:  timeout,
+		client:   &http.Client{Timeout: 30 * time.Second},
+		last:     make(map[string]time.Time),
+		running:  make(map[string]bool),
+	}
+}
+
+// SetCredentials 设置传给命令的 API token 与 HMAC 密钥 (环境变量 HOSTBOOST_TOKEN、
+// HOSTBOOST_HMAC_SECRET), 使 cf_opt 等命令无需单独配置即可通过 /opt/report 上报
+func (r *Reoptimizer) SetCredentials(token, secret string) {
+	if r == nil {
+		return
+	}
+
+	r.env = nil
+	if token != "" {
+		r.env = append(r.env, "HOSTBOOST_TOKEN="+token)
+	}
+	if secret != "" {
+		r.env = append(r.env, "HOSTBOOST_HMAC_SECRET="+secret)
+	}
+}
+
+// Trigger 在后台启动一次重新优选; force 为 true 时忽略冷却时间(手动触发)
+func (r *Reoptimizer) Trigger(optType, reason string, force bool) error {
+	if r == nil {
+		return ErrReoptimizeDisabled
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.running[optType] {
+		return ErrReoptimizeRunning
+	}
+	if last, ok := r.last[optType]; ok && !force {
+		if wait := r.cooldown - time.Since(last); wait > 0 {
+			return fmt.Errorf("%w, retry in %s", ErrReoptimizeCooldown, wait.Round(time.Second))
+		}
+	}
+
+	r.last[optType] = time.Now()
+	r.running[optType] = true
+	go r.run(optType, reason)
+
+	return nil
+}
+
+// LastTriggered 返回指定类型最近一次触发的时间
+func (r *Reoptimizer) LastTriggered(optType string) (time.Time, bool) {
+	if r == nil {
+		return time.Time{}, false
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	last, ok := r.last[optType]
+	return last, ok
+}
+
+func (r *Reoptimizer) run(optType, reason string) {
+	defer func() {
+		r.mu.Lock()
+		delete(r.running, optType)
+		r.mu.Unlock()
+	}()
+
+	log.Printf("Requesting re-optimization (type=%s): %s", optType, reason)
+
+	if r.url != "" {
+		if err := r.post(optType, reason); err != nil {
+			log.Printf("Warning: optimizer endpoint failed (type=%s): %v", optType, err)
+		}
+	}
+
+	if len(r.command) > 0 {
+		// 优选结果由命令自行通过 /opt/report 上报
+		ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+		defer cancel()
+
+		cmd := exec.CommandContext(ctx, r.command[0], r.command[1:]...)
+		cmd.Env = append(os.Environ(), "HOSTBOOST_OPT_TYPE="+optType, "HOSTBOOST_OPT_REASON="+reason)
+		cmd.Env = append(cmd.Env, r.env...)
+		cmd.WaitDelay = 10 * time.Second // 子进程仍占用输出管道时不无限等待
+		output, err := cmd.CombinedOutput()
+		if ctx.Err() == context.DeadlineExceeded {
+			err = fmt.Errorf("killed after %s: %w", r.timeout, err)
+		}
+		if err != nil {
+			log.Printf("Warning: optimizer command failed (type=%s): %v\n%s", optType, err, tail(output, 2048))
+			return
+		}
+		log.Printf("Optimizer command finished (type=%s)", optType)
+	}
+}
+
+func (r *Reoptimizer) post(optType, reason string) error {
+	body, err := json.Marshal(ReoptimizeRequest{Type: optType, Reason: reason})
+	if err != nil {
+		return err
+	}
+
+	resp, err := r.client.Post(r.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// tail 返回输出的最后 n 个字节
+func tail(output []byte, n int) []byte {
+	if len(output) > n {
+		return output[len(output)-n:]
+	}
+	return output
+}
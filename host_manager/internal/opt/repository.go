@@ -5,7 +5,9 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"sort"
 	"sync"
+	"time"
 )
 
 var (
@@ -15,18 +17,44 @@ var (
 	ErrOnlyOneOptRemains = errors.New("优选 IP 存量不足, 无法更换IP, 考虑重新进行优选操作")
 )
 
-// Repository 优选数据仓库
-type Repository struct {
+// Repository 优选数据仓库接口, FileRepository 使用 JSON 文件, SQLiteRepository 使用 SQLite
+type Repository interface {
+	// SaveOptData 过滤掉隔离期内的 IP 后保存, 返回实际保存的列表
+	SaveOptData(optType string, data []OptInfo) ([]OptInfo, error)
+	// MergeOptData 在同一次写入中读取现有优选池, 与 incoming 合并(见 mergeOptData)并过滤隔离期内的 IP 后保存,
+	// 返回合并前(从当前优选开始)与实际保存的列表
+	MergeOptData(optType string, incoming []OptInfo, opts MergeOptions, now time.Time) (before, saved []OptInfo, err error)
+	GetCurrentOpt(optType string) (string, OptInfo, error)
+	GetCandidates(optType string, n int) ([]OptInfo, error)
+	// ChangeToNext 删除当前优选并切换到下一个; quarantine 不为 nil 时将被删除的 IP 加入隔离
+	ChangeToNext(optType string, quarantine *QuarantineEntry) error
+	GetAllTypes() []string
+	GetOptListSize(optType string) int
+	// Snapshot 返回所有类型的优选数据(含当前索引), key 为 type
+	Snapshot() (map[string]OptData, error)
+	// Restore 用给定数据整体替换所有类型的优选数据
+	Restore(data map[string]OptData) error
+	// ListQuarantine 返回仍在冷却期内的隔离记录, optType 为空时返回所有类型
+	ListQuarantine(optType string) ([]QuarantineEntry, error)
+	// ClearQuarantine 解除隔离, ip 为空时解除该类型的全部记录, 返回解除的数量
+	ClearQuarantine(optType, ip string) (int, error)
+}
+
+// FileRepository 基于 JSON 文件的优选数据仓库
+type FileRepository struct {
 	mu       sync.RWMutex
 	filePath string              // JSON 文件路径
 	store    map[string]*OptData // key 为 type
+	// quarantine 各类型的隔离记录, 与优选数据分开保存, 类型被移除后仍然保留
+	quarantine map[string][]QuarantineEntry
 }
 
-// NewRepository 创建新的优选数据仓库
-func NewRepository(filePath string) (*Repository, error) {
-	repo := &Repository{
-		filePath: filePath,
-		store:    make(map[string]*OptData),
+// NewFileRepository 创建基于 JSON 文件的优选数据仓库
+func NewFileRepository(filePath string) (*FileRepository, error) {
+	repo := &FileRepository{
+		filePath:   filePath,
+		store:      make(map[string]*OptData),
+		quarantine: make(map[string][]QuarantineEntry),
 	}
 
 	// 尝试从文件加载数据
@@ -41,7 +69,7 @@ func NewRepository(filePath string) (*Repository, error) {
 }
 
 // load 从 JSON 文件加载数据
-func (r *Repository) load() error {
+func (r *FileRepository) load() error {
 	data, err := os.ReadFile(r.filePath)
 	if err != nil {
 		return err
@@ -56,14 +84,29 @@ func (r *Repository) load() error {
 	if r.store == nil {
 		r.store = make(map[string]*OptData)
 	}
+	r.quarantine = optStore.Quarantine
+	if r.quarantine == nil {
+		r.quarantine = make(map[string][]QuarantineEntry)
+	}
 
 	return nil
 }
 
 // save 保存数据到 JSON 文件
-func (r *Repository) save() error {
+func (r *FileRepository) save() error {
+	// 写入前清理已过期的隔离记录
+	now := time.Now()
+	for t, entries := range r.quarantine {
+		if active := activeQuarantine(entries, now); len(active) > 0 {
+			r.quarantine[t] = active
+		} else {
+			delete(r.quarantine, t)
+		}
+	}
+
 	optStore := OptStore{
-		Opts: r.store,
+		Opts:       r.store,
+		Quarantine: r.quarantine,
 	}
 
 	data, err := json.MarshalIndent(optStore, "", "  ")
@@ -79,25 +122,59 @@ func (r *Repository) save() error {
 }
 
 // SaveOptData 保存优选数据(type 相同则替换,不同则新增)
-func (r *Repository) SaveOptData(optType string, data []OptInfo) error {
+func (r *FileRepository) SaveOptData(optType string, data []OptInfo) ([]OptInfo, error) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
 	if optType == "" {
-		return ErrInvalidType
+		return nil, ErrInvalidType
+	}
+
+	return r.replace(optType, data, time.Now())
+}
+
+// MergeOptData 与现有优选池合并后保存, 读取与写入在同一把锁内完成, 并发上报不会互相覆盖
+func (r *FileRepository) MergeOptData(optType string, incoming []OptInfo, opts MergeOptions, now time.Time) ([]OptInfo, []OptInfo, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if optType == "" {
+		return nil, nil, ErrInvalidType
+	}
+
+	var before []OptInfo
+	if optData, exists := r.store[optType]; exists {
+		before, _ = optData.candidates(0)
+	}
+
+	merged := mergeOptData(before, incoming, opts, now)
+	if len(merged) == 0 {
+		return before, nil, ErrEmptyOptList
+	}
+
+	saved, err := r.replace(optType, merged, now)
+	return before, saved, err
+}
+
+// replace 过滤隔离期内的 IP 后替换该类型的优选数据并保存, 调用方需持有写锁
+func (r *FileRepository) replace(optType string, data []OptInfo, now time.Time) ([]OptInfo, error) {
+	data = filterQuarantined(data, r.quarantine[optType], now)
+	if len(data) == 0 {
+		return nil, ErrAllQuarantined
 	}
 
 	r.store[optType] = &OptData{
-		Type:    optType,
-		Data:    data,
-		Current: 0,
+		Type:       optType,
+		Data:       data,
+		Current:    0,
+		ReportedAt: &now,
 	}
 
-	return r.save()
+	return data, r.save()
 }
 
 // GetCurrentOpt 获取指定类型的当前优选
-func (r *Repository) GetCurrentOpt(optType string) (string, OptInfo, error) {
+func (r *FileRepository) GetCurrentOpt(optType string) (string, OptInfo, error) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
@@ -117,8 +194,25 @@ func (r *Repository) GetCurrentOpt(optType string) (string, OptInfo, error) {
 	return optType, optData.Data[optData.Current], nil
 }
 
+// GetCandidates 从当前优选开始按顺序返回至多 n 个优选(到达末尾后从头继续)
+func (r *FileRepository) GetCandidates(optType string, n int) ([]OptInfo, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if optType == "" {
+		return nil, ErrInvalidType
+	}
+
+	optData, exists := r.store[optType]
+	if !exists {
+		return nil, ErrNoOptDataFound
+	}
+
+	return optData.candidates(n)
+}
+
 // ChangeToNext 切换到下一个优选,并删除当前的
-func (r *Repository) ChangeToNext(optType string) error {
+func (r *FileRepository) ChangeToNext(optType string, quarantine *QuarantineEntry) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
@@ -131,27 +225,23 @@ func (r *Repository) ChangeToNext(optType string) error {
 		return ErrEmptyOptList
 	}
 
-	// 删除当前的
-	if optData.Current < len(optData.Data) {
-		optData.Data = append(optData.Data[:optData.Current], optData.Data[optData.Current+1:]...)
+	if quarantine != nil && optData.Current < len(optData.Data) {
+		entry := *quarantine
+		entry.Type = optType
+		entry.IP = optData.Data[optData.Current].IP
+		r.quarantine[optType] = putQuarantine(r.quarantine[optType], entry, time.Now())
 	}
 
-	// 如果删除后列表为空
-	if len(optData.Data) == 0 {
+	// 删除当前的, 如果删除后列表为空则移除该类型
+	if !optData.dropCurrent() {
 		delete(r.store, optType)
-		return r.save()
-	}
-
-	// 如果当前索引超出范围,重置为 0
-	if optData.Current >= len(optData.Data) {
-		optData.Current = 0
 	}
 
 	return r.save()
 }
 
 // GetAllTypes 获取所有优选类型
-func (r *Repository) GetAllTypes() []string {
+func (r *FileRepository) GetAllTypes() []string {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
@@ -162,8 +252,99 @@ func (r *Repository) GetAllTypes() []string {
 	return types
 }
 
+// Snapshot 返回所有类型的优选数据副本
+func (r *FileRepository) Snapshot() (map[string]OptData, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	result := make(map[string]OptData, len(r.store))
+	for t, optData := range r.store {
+		copied := *optData
+		copied.Data = append([]OptInfo(nil), optData.Data...)
+		result[t] = copied
+	}
+	return result, nil
+}
+
+// Restore 用给定数据整体替换所有类型的优选数据
+func (r *FileRepository) Restore(data map[string]OptData) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	previous := r.store
+	r.store = make(map[string]*OptData, len(data))
+	for t, optData := range data {
+		copied := optData
+		copied.Type = t
+		r.store[t] = &copied
+	}
+
+	if err := r.save(); err != nil {
+		r.store = previous
+		return err
+	}
+	return nil
+}
+
+// ListQuarantine 返回仍在冷却期内的隔离记录, 按类型和隔离时间排序
+func (r *FileRepository) ListQuarantine(optType string) ([]QuarantineEntry, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	now := time.Now()
+	result := make([]QuarantineEntry, 0)
+	for t, entries := range r.quarantine {
+		if optType != "" && t != optType {
+			continue
+		}
+		result = append(result, activeQuarantine(entries, now)...)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Type != result[j].Type {
+			return result[i].Type < result[j].Type
+		}
+		return result[i].Since.Before(result[j].Since)
+	})
+	return result, nil
+}
+
+// ClearQuarantine 解除指定类型中 ip 的隔离, ip 为空时解除该类型的全部隔离
+func (r *FileRepository) ClearQuarantine(optType, ip string) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if optType == "" {
+		return 0, ErrInvalidType
+	}
+
+	now := time.Now()
+	kept := make([]QuarantineEntry, 0)
+	cleared := 0
+	for _, e := range r.quarantine[optType] {
+		if !e.Active(now) {
+			continue
+		}
+		if ip == "" || e.IP == ip {
+			cleared++
+			continue
+		}
+		kept = append(kept, e)
+	}
+	if cleared == 0 {
+		return 0, nil
+	}
+
+	previous := r.quarantine[optType]
+	r.quarantine[optType] = kept
+	if err := r.save(); err != nil {
+		r.quarantine[optType] = previous
+		return 0, err
+	}
+	return cleared, nil
+}
+
 // GetOptListSize 获取指定类型的优选列表大小
-func (r *Repository) GetOptListSize(optType string) int {
+func (r *FileRepository) GetOptListSize(optType string) int {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
@@ -172,3 +353,35 @@ func (r *Repository) GetOptListSize(optType string) int {
 	}
 	return 0
 }
+
+// candidates 从当前优选开始按顺序返回至多 n 个优选(到达末尾后从头继续)
+func (d *OptData) candidates(n int) ([]OptInfo, error) {
+	if len(d.Data) == 0 || d.Current >= len(d.Data) {
+		return nil, ErrNoOptDataFound
+	}
+
+	if n <= 0 || n > len(d.Data) {
+		n = len(d.Data)
+	}
+
+	result := make([]OptInfo, 0, n)
+	for i := 0; i < n; i++ {
+		result = append(result, d.Data[(d.Current+i)%len(d.Data)])
+	}
+
+	return result, nil
+}
+
+// dropCurrent 删除当前优选并修正索引, 返回删除后列表是否仍非空
+func (d *OptData) dropCurrent() bool {
+	if d.Current < len(d.Data) {
+		d.Data = append(d.Data[:d.Current], d.Data[d.Current+1:]...)
+	}
+
+	// 如果当前索引超出范围,重置为 0
+	if d.Current >= len(d.Data) {
+		d.Current = 0
+	}
+
+	return len(d.Data) > 0
+}
@@ -0,0 +1,34 @@
+package opt
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileRepositoryChangeToNextStaleCurrent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "opts.json")
+	content := `{"opts":{"cloudflare":{"type":"cloudflare","data":[{"ip":"1.1.1.1"},{"ip":"2.2.2.2"}],"current":5}}}`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("write opts: %v", err)
+	}
+
+	repo, err := NewFileRepository(path)
+	if err != nil {
+		t.Fatalf("open repository: %v", err)
+	}
+
+	now := time.Now()
+	if err := repo.ChangeToNext("cloudflare", &QuarantineEntry{Since: now, Until: now.Add(time.Hour)}); err != nil {
+		t.Fatalf("change: %v", err)
+	}
+
+	_, current, err := repo.GetCurrentOpt("cloudflare")
+	if err != nil {
+		t.Fatalf("get current: %v", err)
+	}
+	if current.IP != "1.1.1.1" {
+		t.Fatalf("current = %s, want 1.1.1.1", current.IP)
+	}
+}
@@ -1,44 +1,171 @@
 package opt
 
 import (
+	"encoding/json"
+	"fmt"
 	"hostMgr/hostsync"
+	"hostMgr/internal/audit"
 	"hostMgr/internal/extSvc"
+	"hostMgr/internal/revision"
 	"log"
+	"time"
 )
 
 // Service 优选服务
 type Service struct {
-	repo   *Repository
-	syncer *hostsync.Syncer
+	repo      Repository
+	syncer    *hostsync.Syncer
+	audit     *audit.Logger
+	revisions *revision.Manager
+	history   HistoryStore
+	retention time.Duration // 上报历史保留时长, 0 表示永久保留
+	cooldown  time.Duration // 被更换 IP 的隔离时长, 0 表示不隔离
+
+	maxAge      time.Duration // 优选数据的最大有效期, 0 表示不检查
+	minPool     int           // 优选池的最少 IP 数量
+	reoptimizer *Reoptimizer
+	merge       MergeOptions
 }
 
-// NewService 创建新的优选服务
-func NewService(repo *Repository, hostPath string) *Service {
+// NewService 创建新的优选服务, syncer 与 host service 共用
+func NewService(repo Repository, syncer *hostsync.Syncer) *Service {
 	return &Service{
 		repo:   repo,
-		syncer: hostsync.NewSyncer(hostPath),
+		syncer: syncer,
+	}
+}
+
+// SetAuditLogger 设置审计日志, 记录每次上报与更换
+func (s *Service) SetAuditLogger(logger *audit.Logger) {
+	s.audit = logger
+}
+
+// SetRevisions 将优选数据注册到版本管理, 每次上报与更换后生成快照
+func (s *Service) SetRevisions(m *revision.Manager) {
+	s.revisions = m
+	m.AddSource("opts", revision.Source{
+		Snapshot: func() (map[string]interface{}, error) {
+			data, err := s.repo.Snapshot()
+			if err != nil {
+				return nil, err
+			}
+			items := make(map[string]interface{}, len(data))
+			for t, optData := range data {
+				items[t] = optData
+			}
+			return items, nil
+		},
+		Decode: func(items map[string]json.RawMessage) (func() error, error) {
+			data := make(map[string]OptData, len(items))
+			for t, raw := range items {
+				var optData OptData
+				if err := json.Unmarshal(raw, &optData); err != nil {
+					return nil, fmt.Errorf("opt type %s: %w", t, err)
+				}
+				data[t] = optData
+			}
+			return func() error { return s.repo.Restore(data) }, nil
+		},
+	})
+}
+
+// SetHistory 设置上报历史存储, 超过 retention 的记录在每次上报时清理
+func (s *Service) SetHistory(store HistoryStore, retention time.Duration) {
+	s.history = store
+	s.retention = retention
+}
+
+// SetQuarantineCooldown 设置被更换 IP 的隔离时长, 冷却期内再次上报的同一 IP 会被过滤
+func (s *Service) SetQuarantineCooldown(cooldown time.Duration) {
+	s.cooldown = cooldown
+}
+
+// GetHistory 按时间先后返回上报历史
+func (s *Service) GetHistory(q HistoryQuery) ([]OptReport, error) {
+	if s.history == nil {
+		return []OptReport{}, nil
+	}
+	return s.history.Query(q)
+}
+
+// recordHistory 保存一次上报到历史并清理过期记录, 失败时只记录日志
+func (s *Service) recordHistory(req ReportRequest, cause audit.Cause) {
+	if s.history == nil {
+		return
+	}
+
+	reporter := req.Reporter
+	if reporter == "" {
+		reporter = cause.Client
+	}
+
+	now := time.Now()
+	report := OptReport{Time: now, Type: req.Type, Reporter: reporter, Data: req.Data}
+	if err := s.history.Append(&report); err != nil {
+		log.Printf("Warning: failed to record opt report history (type=%s): %v", req.Type, err)
+		return
+	}
+
+	if s.retention > 0 {
+		if n, err := s.history.Prune(now.Add(-s.retention)); err != nil {
+			log.Printf("Warning: failed to prune opt report history: %v", err)
+		} else if n > 0 {
+			log.Printf("Pruned %d opt report(s) older than %s", n, s.retention)
+		}
 	}
 }
 
 // HostService 定义 host service 接口，用于避免循环依赖
 type HostService interface {
-	UpdateHostsByType(hostType string) (int, error)
+	UpdateHostsByType(hostType string, cause audit.Cause) (int, error)
 }
 
 // ReportOpt 上报优选数据
-func (s *Service) ReportOpt(req ReportRequest) error {
+func (s *Service) ReportOpt(req ReportRequest, cause audit.Cause) error {
 	if len(req.Data) == 0 {
 		return ErrEmptyOptList
 	}
+	cause = cause.Or("opt report")
 
-	// 保存优选数据
-	if err := s.repo.SaveOptData(req.Type, req.Data); err != nil {
+	mode, err := s.reportMode(req.Mode)
+	if err != nil {
 		return err
 	}
 
+	// 未携带测速时间的优选以上报时间为准
+	now := time.Now()
+	for i := range req.Data {
+		if req.Data[i].TestedAt == nil {
+			req.Data[i].TestedAt = &now
+		}
+	}
+
+	// 保存优选数据, 隔离期内的 IP 会被过滤
+	var before, saved []OptInfo
+	if mode == ReportModeMerge {
+		// 合并模式下与现有优选池合并去重并按评分排序, 读取与保存由仓库原子完成
+		before, saved, err = s.repo.MergeOptData(req.Type, req.Data, s.merge, now)
+		if err != nil {
+			return err
+		}
+		log.Printf("Merged %d reported IP(s) into opt pool of %d (type=%s)", len(req.Data), len(saved), req.Type)
+	} else {
+		// 记录上报前的优选列表(从当前优选开始)
+		before, _ = s.repo.GetCandidates(req.Type, 0)
+		saved, err = s.repo.SaveOptData(req.Type, req.Data)
+		if err != nil {
+			return err
+		}
+		if skipped := len(req.Data) - len(saved); skipped > 0 {
+			log.Printf("Skipped %d quarantined IP(s) in opt report (type=%s)", skipped, req.Type)
+		}
+	}
+	s.audit.Record(cause, audit.ActionOptReport, req.Type, before, saved)
+	s.recordHistory(req, cause)
+
 	// 调用 host service 的 UpdateHostsByType 方法更新相关主机的 IP
 	if hostSvc, ok := extSvc.HostService.(HostService); ok && hostSvc != nil {
-		count, err := hostSvc.UpdateHostsByType(req.Type)
+		count, err := hostSvc.UpdateHostsByType(req.Type, cause)
 		if err != nil {
 			// 记录错误但不影响优选数据的保存
 			log.Printf("Warning: failed to update hosts after reporting opt (type=%s): %v", req.Type, err)
@@ -49,6 +176,8 @@ func (s *Service) ReportOpt(req ReportRequest) error {
 		log.Printf("Warning: host service not available for updating hosts (type=%s)", req.Type)
 	}
 
+	s.revisions.Capture(cause)
+
 	// 同步到系统 hosts 文件
 	if err := s.syncer.Sync(); err != nil {
 		log.Printf("Warning: failed to sync hosts to system: %v", err)
@@ -62,25 +191,50 @@ func (s *Service) GetCurrentOpt(optType string) (string, OptInfo, error) {
 	return s.repo.GetCurrentOpt(optType)
 }
 
+// GetCandidates 从当前优选开始按顺序获取至多 n 个优选
+func (s *Service) GetCandidates(optType string, n int) ([]OptInfo, error) {
+	return s.repo.GetCandidates(optType, n)
+}
+
 // ChangeOpt 更换指定类型的当前优选
-func (s *Service) ChangeOpt(optType string) error {
+func (s *Service) ChangeOpt(optType string, cause audit.Cause) error {
 	// 检查列表数量，如果只剩一个 IP 则阻止更换
 	listSize := s.repo.GetOptListSize(optType)
 	if listSize == 0 {
 		return ErrNoOptDataFound
 	}
 	if listSize <= 1 {
+		// 存量耗尽时顺带请求重新优选
+		if err := s.reoptimizer.Trigger(optType, "opt pool exhausted", false); err == nil {
+			log.Printf("Opt pool exhausted, re-optimization requested (type=%s)", optType)
+		}
 		return ErrOnlyOneOptRemains
 	}
 
-	// 更换到下一个优选
-	if err := s.repo.ChangeToNext(optType); err != nil {
+	cause = cause.Or("opt change")
+	_, before, _ := s.repo.GetCurrentOpt(optType)
+
+	// 更换到下一个优选, 被换掉的 IP 进入隔离
+	var quarantine *QuarantineEntry
+	if s.cooldown > 0 {
+		now := time.Now()
+		quarantine = &QuarantineEntry{
+			Actor:  cause.Actor,
+			Reason: cause.Reason,
+			Since:  now,
+			Until:  now.Add(s.cooldown),
+		}
+	}
+	if err := s.repo.ChangeToNext(optType, quarantine); err != nil {
 		return err
 	}
 
+	_, after, _ := s.repo.GetCurrentOpt(optType)
+	s.audit.Record(cause, audit.ActionOptChange, optType, before, after)
+
 	// 调用 host service 的 UpdateHostsByType 方法更新相关主机的 IP
 	if hostSvc, ok := extSvc.HostService.(HostService); ok && hostSvc != nil {
-		count, err := hostSvc.UpdateHostsByType(optType)
+		count, err := hostSvc.UpdateHostsByType(optType, cause)
 		if err != nil {
 			// 记录错误但不影响优选的更换
 			log.Printf("Warning: failed to update hosts after changing opt (type=%s): %v", optType, err)
@@ -91,6 +245,8 @@ func (s *Service) ChangeOpt(optType string) error {
 		log.Printf("Warning: host service not available for updating hosts after changing opt (type=%s)", optType)
 	}
 
+	s.revisions.Capture(cause)
+
 	// 同步到系统 hosts 文件
 	if err := s.syncer.Sync(); err != nil {
 		log.Printf("Warning: failed to sync hosts to system: %v", err)
@@ -103,3 +259,29 @@ func (s *Service) ChangeOpt(optType string) error {
 func (s *Service) GetAllTypes() []string {
 	return s.repo.GetAllTypes()
 }
+
+// GetQuarantine 返回仍在冷却期内的隔离记录, optType 为空时返回所有类型
+func (s *Service) GetQuarantine(optType string) ([]QuarantineEntry, error) {
+	return s.repo.ListQuarantine(optType)
+}
+
+// ClearQuarantine 解除隔离, ip 为空时解除该类型的全部隔离, 返回解除的数量
+func (s *Service) ClearQuarantine(optType, ip string, cause audit.Cause) (int, error) {
+	cause = cause.Or("quarantine cleared")
+
+	before, err := s.repo.ListQuarantine(optType)
+	if err != nil {
+		return 0, err
+	}
+
+	cleared, err := s.repo.ClearQuarantine(optType, ip)
+	if err != nil || cleared == 0 {
+		return cleared, err
+	}
+
+	after, _ := s.repo.ListQuarantine(optType)
+	s.audit.Record(cause, audit.ActionOptQuarantineClear, optType, before, after)
+	log.Printf("Cleared %d quarantined IP(s) (type=%s)", cleared, optType)
+
+	return cleared, nil
+}
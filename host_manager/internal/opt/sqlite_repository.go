@@ -0,0 +1,454 @@
+package opt
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"hostMgr/internal/store"
+)
+
+// SQLiteRepository 基于 SQLite 的优选数据仓库, 每个类型一行, 优选列表以 JSON 存储
+type SQLiteRepository struct {
+	db *sql.DB
+}
+
+var (
+	_ Repository = (*FileRepository)(nil)
+	_ Repository = (*SQLiteRepository)(nil)
+)
+
+// NewSQLiteRepository 创建 opts 表(如不存在)并返回仓库
+func NewSQLiteRepository(db *sql.DB) (*SQLiteRepository, error) {
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS opts (
+		type        TEXT PRIMARY KEY,
+		current     INTEGER NOT NULL DEFAULT 0,
+		data        TEXT NOT NULL DEFAULT '[]',
+		reported_at INTEGER
+	)`); err != nil {
+		return nil, fmt.Errorf("create opts table: %w", err)
+	}
+
+	// 早期版本创建的表没有 reported_at 列
+	if err := store.EnsureColumn(db, "opts", "reported_at", "INTEGER"); err != nil {
+		return nil, err
+	}
+
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS opt_quarantine (
+		type   TEXT NOT NULL,
+		ip     TEXT NOT NULL,
+		actor  TEXT NOT NULL DEFAULT '',
+		reason TEXT NOT NULL DEFAULT '',
+		since  INTEGER NOT NULL,
+		until  INTEGER NOT NULL,
+		PRIMARY KEY (type, ip)
+	)`); err != nil {
+		return nil, fmt.Errorf("create opt_quarantine table: %w", err)
+	}
+
+	return &SQLiteRepository{db: db}, nil
+}
+
+// SaveOptData 保存优选数据(type 相同则替换,不同则新增)
+func (r *SQLiteRepository) SaveOptData(optType string, data []OptInfo) ([]OptInfo, error) {
+	if optType == "" {
+		return nil, ErrInvalidType
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	data, err = replaceOptData(tx, optType, data, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	return data, tx.Commit()
+}
+
+// MergeOptData 与现有优选池合并后保存, 读取与写入在同一个事务内完成, 并发上报不会互相覆盖
+func (r *SQLiteRepository) MergeOptData(optType string, incoming []OptInfo, opts MergeOptions, now time.Time) ([]OptInfo, []OptInfo, error) {
+	if optType == "" {
+		return nil, nil, ErrInvalidType
+	}
+
+	// 数据库只有一个连接(见 store.OpenSQLite), 事务之间不会交错
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	optData, err := getOptData(tx, optType)
+	if err != nil {
+		return nil, nil, err
+	}
+	var before []OptInfo
+	if optData != nil {
+		before, _ = optData.candidates(0)
+	}
+
+	merged := mergeOptData(before, incoming, opts, now)
+	if len(merged) == 0 {
+		return before, nil, ErrEmptyOptList
+	}
+
+	saved, err := replaceOptData(tx, optType, merged, now)
+	if err != nil {
+		return before, nil, err
+	}
+
+	return before, saved, tx.Commit()
+}
+
+// GetCurrentOpt 获取指定类型的当前优选
+func (r *SQLiteRepository) GetCurrentOpt(optType string) (string, OptInfo, error) {
+	if optType == "" {
+		return "", OptInfo{}, ErrInvalidType
+	}
+
+	candidates, err := r.GetCandidates(optType, 1)
+	if err != nil {
+		return "", OptInfo{}, err
+	}
+
+	return optType, candidates[0], nil
+}
+
+// GetCandidates 从当前优选开始按顺序返回至多 n 个优选(到达末尾后从头继续)
+func (r *SQLiteRepository) GetCandidates(optType string, n int) ([]OptInfo, error) {
+	if optType == "" {
+		return nil, ErrInvalidType
+	}
+
+	optData, err := getOptData(r.db, optType)
+	if err != nil {
+		return nil, err
+	}
+	if optData == nil {
+		return nil, ErrNoOptDataFound
+	}
+
+	return optData.candidates(n)
+}
+
+// ChangeToNext 切换到下一个优选,并删除当前的
+func (r *SQLiteRepository) ChangeToNext(optType string, quarantine *QuarantineEntry) error {
+	if optType == "" {
+		return ErrInvalidType
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	optData, err := getOptData(tx, optType)
+	if err != nil {
+		return err
+	}
+	if optData == nil || len(optData.Data) == 0 {
+		return ErrEmptyOptList
+	}
+
+	if quarantine != nil && optData.Current < len(optData.Data) {
+		entry := *quarantine
+		entry.Type = optType
+		entry.IP = optData.Data[optData.Current].IP
+		if _, err := tx.Exec(`INSERT INTO opt_quarantine (type, ip, actor, reason, since, until) VALUES (?, ?, ?, ?, ?, ?)
+			ON CONFLICT(type, ip) DO UPDATE SET actor = excluded.actor, reason = excluded.reason,
+				since = excluded.since, until = excluded.until`,
+			entry.Type, entry.IP, entry.Actor, entry.Reason, entry.Since.UnixNano(), entry.Until.UnixNano()); err != nil {
+			return err
+		}
+	}
+
+	// 删除当前的, 如果删除后列表为空则移除该类型
+	if optData.dropCurrent() {
+		err = putOptData(tx, optData)
+	} else {
+		_, err = tx.Exec(`DELETE FROM opts WHERE type = ?`, optType)
+	}
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetAllTypes 获取所有优选类型
+func (r *SQLiteRepository) GetAllTypes() []string {
+	rows, err := r.db.Query(`SELECT type FROM opts ORDER BY type`)
+	if err != nil {
+		log.Printf("Warning: failed to list opt types: %v", err)
+		return []string{}
+	}
+	defer rows.Close()
+
+	types := make([]string, 0)
+	for rows.Next() {
+		var t string
+		if err := rows.Scan(&t); err != nil {
+			log.Printf("Warning: failed to list opt types: %v", err)
+			return []string{}
+		}
+		types = append(types, t)
+	}
+
+	return types
+}
+
+// GetOptListSize 获取指定类型的优选列表大小
+func (r *SQLiteRepository) GetOptListSize(optType string) int {
+	optData, err := getOptData(r.db, optType)
+	if err != nil {
+		log.Printf("Warning: failed to read opt data (type=%s): %v", optType, err)
+		return 0
+	}
+	if optData == nil {
+		return 0
+	}
+	return len(optData.Data)
+}
+
+// Snapshot 返回所有类型的优选数据
+func (r *SQLiteRepository) Snapshot() (map[string]OptData, error) {
+	rows, err := r.db.Query(`SELECT type FROM opts`)
+	if err != nil {
+		return nil, err
+	}
+
+	types := make([]string, 0)
+	for rows.Next() {
+		var t string
+		if err := rows.Scan(&t); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		types = append(types, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]OptData, len(types))
+	for _, t := range types {
+		optData, err := getOptData(r.db, t)
+		if err != nil {
+			return nil, err
+		}
+		if optData != nil {
+			result[t] = *optData
+		}
+	}
+	return result, nil
+}
+
+// Restore 在一个事务中用给定数据整体替换所有类型的优选数据
+func (r *SQLiteRepository) Restore(data map[string]OptData) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM opts`); err != nil {
+		return err
+	}
+	for t, optData := range data {
+		optData.Type = t
+		if err := putOptData(tx, &optData); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// ListQuarantine 返回仍在冷却期内的隔离记录, 按类型和隔离时间排序
+func (r *SQLiteRepository) ListQuarantine(optType string) ([]QuarantineEntry, error) {
+	return queryQuarantine(r.db, optType, time.Now())
+}
+
+// ClearQuarantine 解除指定类型中 ip 的隔离, ip 为空时解除该类型的全部隔离
+func (r *SQLiteRepository) ClearQuarantine(optType, ip string) (int, error) {
+	if optType == "" {
+		return 0, ErrInvalidType
+	}
+
+	query := `DELETE FROM opt_quarantine WHERE type = ? AND until > ?`
+	args := []interface{}{optType, time.Now().UnixNano()}
+	if ip != "" {
+		query += ` AND ip = ?`
+		args = append(args, ip)
+	}
+
+	res, err := r.db.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	// 顺便清理过期记录
+	if _, err := r.db.Exec(`DELETE FROM opt_quarantine WHERE until <= ?`, time.Now().UnixNano()); err != nil {
+		log.Printf("Warning: failed to prune expired quarantine entries: %v", err)
+	}
+
+	return int(n), nil
+}
+
+// ImportJSON 将 opts.json 中的优选数据导入数据库, 文件不存在时不导入任何数据
+func (r *SQLiteRepository) ImportJSON(path string) (int, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	var optStore OptStore
+	if err := json.Unmarshal(raw, &optStore); err != nil {
+		return 0, fmt.Errorf("failed to unmarshal opt data: %w", err)
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	imported := 0
+	for optType, optData := range optStore.Opts {
+		if optData == nil || optType == "" {
+			continue
+		}
+		optData.Type = optType
+		if err := putOptData(tx, optData); err != nil {
+			return 0, err
+		}
+		imported++
+	}
+
+	for optType, entries := range optStore.Quarantine {
+		for _, e := range entries {
+			if _, err := tx.Exec(`INSERT OR REPLACE INTO opt_quarantine (type, ip, actor, reason, since, until) VALUES (?, ?, ?, ?, ?, ?)`,
+				optType, e.IP, e.Actor, e.Reason, e.Since.UnixNano(), e.Until.UnixNano()); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	return imported, tx.Commit()
+}
+
+// queryer 由 *sql.DB 和 *sql.Tx 实现
+type queryer interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// queryQuarantine 读取 now 时仍在冷却期内的隔离记录, optType 为空时读取所有类型
+func queryQuarantine(q queryer, optType string, now time.Time) ([]QuarantineEntry, error) {
+	query := `SELECT type, ip, actor, reason, since, until FROM opt_quarantine WHERE until > ?`
+	args := []interface{}{now.UnixNano()}
+	if optType != "" {
+		query += ` AND type = ?`
+		args = append(args, optType)
+	}
+
+	rows, err := q.Query(query+` ORDER BY type, since`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]QuarantineEntry, 0)
+	for rows.Next() {
+		var (
+			e            QuarantineEntry
+			since, until int64
+		)
+		if err := rows.Scan(&e.Type, &e.IP, &e.Actor, &e.Reason, &since, &until); err != nil {
+			return nil, err
+		}
+		e.Since = time.Unix(0, since)
+		e.Until = time.Unix(0, until)
+		result = append(result, e)
+	}
+
+	return result, rows.Err()
+}
+
+// getOptData 读取指定类型的优选数据, 不存在时返回 nil
+func getOptData(q queryer, optType string) (*OptData, error) {
+	var (
+		optData    OptData
+		raw        string
+		reportedAt sql.NullInt64
+	)
+
+	err := q.QueryRow(`SELECT type, current, data, reported_at FROM opts WHERE type = ?`, optType).Scan(&optData.Type, &optData.Current, &raw, &reportedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(raw), &optData.Data); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal opt data (type=%s): %w", optType, err)
+	}
+	if reportedAt.Valid {
+		t := time.Unix(0, reportedAt.Int64)
+		optData.ReportedAt = &t
+	}
+
+	return &optData, nil
+}
+
+// replaceOptData 过滤隔离期内的 IP 后替换该类型的优选数据, 返回实际保存的列表
+func replaceOptData(tx *sql.Tx, optType string, data []OptInfo, now time.Time) ([]OptInfo, error) {
+	entries, err := queryQuarantine(tx, optType, now)
+	if err != nil {
+		return nil, err
+	}
+	data = filterQuarantined(data, entries, now)
+	if len(data) == 0 {
+		return nil, ErrAllQuarantined
+	}
+
+	if err := putOptData(tx, &OptData{Type: optType, Data: data, ReportedAt: &now}); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func putOptData(tx *sql.Tx, optData *OptData) error {
+	raw, err := json.Marshal(optData.Data)
+	if err != nil {
+		return fmt.Errorf("failed to marshal opt data: %w", err)
+	}
+
+	var reportedAt sql.NullInt64
+	if optData.ReportedAt != nil {
+		reportedAt = sql.NullInt64{Int64: optData.ReportedAt.UnixNano(), Valid: true}
+	}
+
+	_, err = tx.Exec(`INSERT INTO opts (type, current, data, reported_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT(type) DO UPDATE SET current = excluded.current, data = excluded.data, reported_at = excluded.reported_at`,
+		optData.Type, optData.Current, string(raw), reportedAt)
+	return err
+}
@@ -0,0 +1,172 @@
+package revision
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// FileStore keeps one JSON file per revision in a directory.
+type FileStore struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// NewFileStore creates the revision directory if needed.
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+// Append writes the revision as the next numbered file.
+func (s *FileStore) Append(r *Revision) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids, err := s.ids()
+	if err != nil {
+		return err
+	}
+
+	r.ID = 1
+	if len(ids) > 0 {
+		r.ID = ids[len(ids)-1] + 1
+	}
+
+	payload, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(s.dir, "rev-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(payload); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.path(r.ID))
+}
+
+// Get reads the revision with the given ID.
+func (s *FileStore) Get(id int64) (Revision, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.read(id)
+}
+
+// Latest reads the newest revision.
+func (s *FileStore) Latest() (Revision, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids, err := s.ids()
+	if err != nil {
+		return Revision{}, err
+	}
+	if len(ids) == 0 {
+		return Revision{}, ErrRevisionNotFound
+	}
+
+	return s.read(ids[len(ids)-1])
+}
+
+// List returns up to limit summaries, newest first.
+func (s *FileStore) List(limit int) ([]Summary, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids, err := s.ids()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]Summary, 0, limit)
+	for i := len(ids) - 1; i >= 0 && len(result) < limit; i-- {
+		r, err := s.read(ids[i])
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, r.Summary())
+	}
+
+	return result, nil
+}
+
+// Prune deletes all but the newest keep revision files.
+func (s *FileStore) Prune(keep int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids, err := s.ids()
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < len(ids)-keep; i++ {
+		if err := os.Remove(s.path(ids[i])); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *FileStore) read(id int64) (Revision, error) {
+	data, err := os.ReadFile(s.path(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return Revision{}, ErrRevisionNotFound
+		}
+		return Revision{}, err
+	}
+
+	var r Revision
+	if err := json.Unmarshal(data, &r); err != nil {
+		return Revision{}, fmt.Errorf("parse %s: %w", s.path(id), err)
+	}
+	return r, nil
+}
+
+// ids returns the IDs of the stored revisions in ascending order.
+func (s *FileStore) ids() ([]int64, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]int64, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, "rev-") || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		id, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimPrefix(name, "rev-"), ".json"), 10, 64)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids, nil
+}
+
+func (s *FileStore) path(id int64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("rev-%06d.json", id))
+}
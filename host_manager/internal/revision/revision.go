@@ -0,0 +1,368 @@
+package revision
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"hostMgr/hostsync"
+	"hostMgr/internal/audit"
+)
+
+// ErrRevisionNotFound indicates the requested revision does not exist or was pruned.
+var ErrRevisionNotFound = errors.New("revision not found")
+
+// State is the managed state captured by a revision: for each source (e.g.
+// "hosts", "opts") the items keyed by domain or type.
+type State map[string]map[string]json.RawMessage
+
+// Revision is a numbered snapshot of the managed state.
+type Revision struct {
+	ID     int64     `json:"id"`
+	Time   time.Time `json:"time"`
+	Actor  string    `json:"actor"`
+	Reason string    `json:"reason,omitempty"`
+	State  State     `json:"state"`
+}
+
+// Summary describes a revision without its state.
+type Summary struct {
+	ID     int64          `json:"id"`
+	Time   time.Time      `json:"time"`
+	Actor  string         `json:"actor"`
+	Reason string         `json:"reason,omitempty"`
+	Counts map[string]int `json:"counts"` // number of items per source
+}
+
+// Summary returns the summary of r.
+func (r Revision) Summary() Summary {
+	counts := make(map[string]int, len(r.State))
+	for source, items := range r.State {
+		counts[source] = len(items)
+	}
+	return Summary{ID: r.ID, Time: r.Time, Actor: r.Actor, Reason: r.Reason, Counts: counts}
+}
+
+// Change is a single item that differs between two revisions.
+type Change struct {
+	Source string          `json:"source"`
+	Key    string          `json:"key"`
+	Kind   string          `json:"kind"` // added, removed or changed
+	Before json.RawMessage `json:"before,omitempty"`
+	After  json.RawMessage `json:"after,omitempty"`
+}
+
+// Diff is the difference between two revisions.
+type Diff struct {
+	From    int64    `json:"from"`
+	To      int64    `json:"to"`
+	Changes []Change `json:"changes"`
+}
+
+// Store persists revisions.
+type Store interface {
+	// Append stores the revision and assigns its ID.
+	Append(r *Revision) error
+	// Get returns the revision with the given ID.
+	Get(id int64) (Revision, error)
+	// Latest returns the newest revision, or ErrRevisionNotFound if there is none.
+	Latest() (Revision, error)
+	// List returns up to limit revision summaries, newest first.
+	List(limit int) ([]Summary, error)
+	// Prune removes all but the newest keep revisions.
+	Prune(keep int) error
+}
+
+// Source snapshots and restores one part of the managed state.
+type Source struct {
+	// Snapshot returns the current items keyed by domain or type.
+	Snapshot func() (map[string]interface{}, error)
+	// Decode validates the given items and returns a function that replaces
+	// the current items with them. Rollback decodes every source before
+	// applying any, so a malformed revision changes nothing.
+	Decode func(items map[string]json.RawMessage) (apply func() error, err error)
+}
+
+// Manager captures a revision after every change and rolls back to earlier ones.
+type Manager struct {
+	store   Store
+	syncer  *hostsync.Syncer
+	keep    int
+	audit   *audit.Logger
+	mu      sync.Mutex
+	sources map[string]Source
+}
+
+// NewManager creates a manager keeping the newest keep revisions in store.
+// The syncer re-applies the system hosts file after a rollback.
+func NewManager(store Store, syncer *hostsync.Syncer, keep int) *Manager {
+	if keep <= 0 {
+		keep = 100
+	}
+	return &Manager{
+		store:   store,
+		syncer:  syncer,
+		keep:    keep,
+		sources: make(map[string]Source),
+	}
+}
+
+// SetAuditLogger sets the logger that records rollbacks.
+func (m *Manager) SetAuditLogger(logger *audit.Logger) {
+	m.audit = logger
+}
+
+// AddSource registers a named part of the managed state.
+func (m *Manager) AddSource(name string, source Source) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sources[name] = source
+}
+
+// Capture snapshots the current state as a new revision. Nothing is stored if
+// the state equals the latest revision. A nil *Manager does nothing, so
+// services work unchanged when revisions are not configured.
+func (m *Manager) Capture(cause audit.Cause) {
+	if m == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, err := m.captureLocked(cause); err != nil {
+		log.Printf("Warning: failed to capture revision: %v", err)
+	}
+}
+
+func (m *Manager) captureLocked(cause audit.Cause) (int64, error) {
+	state, err := m.snapshotLocked()
+	if err != nil {
+		return 0, err
+	}
+
+	latest, err := m.store.Latest()
+	if err != nil && !errors.Is(err, ErrRevisionNotFound) {
+		return 0, err
+	}
+	if err == nil && sameState(latest.State, state) {
+		return latest.ID, nil
+	}
+
+	rev := Revision{Time: time.Now(), Actor: cause.Actor, Reason: cause.Reason, State: state}
+	if err := m.store.Append(&rev); err != nil {
+		return 0, err
+	}
+
+	if err := m.store.Prune(m.keep); err != nil {
+		log.Printf("Warning: failed to prune revisions: %v", err)
+	}
+
+	return rev.ID, nil
+}
+
+func (m *Manager) snapshotLocked() (State, error) {
+	state := make(State, len(m.sources))
+	for name, source := range m.sources {
+		items, err := source.Snapshot()
+		if err != nil {
+			return nil, fmt.Errorf("snapshot %s: %w", name, err)
+		}
+
+		encoded := make(map[string]json.RawMessage, len(items))
+		for key, item := range items {
+			data, err := json.Marshal(item)
+			if err != nil {
+				return nil, fmt.Errorf("snapshot %s/%s: %w", name, key, err)
+			}
+			encoded[key] = data
+		}
+		state[name] = encoded
+	}
+	return state, nil
+}
+
+// List returns up to limit revision summaries, newest first.
+func (m *Manager) List(limit int) ([]Summary, error) {
+	if limit <= 0 {
+		limit = m.keep
+	}
+	return m.store.List(limit)
+}
+
+// Diff compares two revisions. A to of 0 compares against the latest revision.
+func (m *Manager) Diff(from, to int64) (Diff, error) {
+	fromRev, err := m.store.Get(from)
+	if err != nil {
+		return Diff{}, fmt.Errorf("revision %d: %w", from, err)
+	}
+
+	var toRev Revision
+	if to == 0 {
+		toRev, err = m.store.Latest()
+	} else {
+		toRev, err = m.store.Get(to)
+	}
+	if err != nil {
+		return Diff{}, fmt.Errorf("revision %d: %w", to, err)
+	}
+
+	return Diff{From: fromRev.ID, To: toRev.ID, Changes: diffStates(fromRev.State, toRev.State)}, nil
+}
+
+// Rollback restores the state of revision id, re-syncs the system hosts file
+// and records the restored state as a new revision, so a rollback can itself
+// be undone. It returns the ID of the new revision.
+func (m *Manager) Rollback(id int64, cause audit.Cause) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	target, err := m.store.Get(id)
+	if err != nil {
+		return 0, fmt.Errorf("revision %d: %w", id, err)
+	}
+
+	current, err := m.snapshotLocked()
+	if err != nil {
+		return 0, err
+	}
+
+	// 先解码所有数据源的目标数据与当前数据，全部成功后才开始写入
+	names := make([]string, 0, len(m.sources))
+	for name := range m.sources {
+		if _, ok := target.State[name]; ok {
+			names = append(names, name) // 目标版本之后才加入的数据源保持现状
+		}
+	}
+	sort.Strings(names)
+
+	applies := make([]func() error, len(names))
+	undos := make([]func() error, len(names))
+	for i, name := range names {
+		if applies[i], err = m.sources[name].Decode(target.State[name]); err != nil {
+			return 0, fmt.Errorf("revision %d: decode %s: %w", id, name, err)
+		}
+		if undos[i], err = m.sources[name].Decode(current[name]); err != nil {
+			return 0, fmt.Errorf("decode current %s: %w", name, err)
+		}
+	}
+
+	for i, name := range names {
+		if err := applies[i](); err != nil {
+			// 写入失败时恢复已写入的数据源，避免只回滚了一部分
+			for j := i; j >= 0; j-- {
+				if undoErr := undos[j](); undoErr != nil {
+					log.Printf("Warning: failed to restore %s after failed rollback: %v", names[j], undoErr)
+				}
+			}
+			return 0, fmt.Errorf("restore %s: %w", name, err)
+		}
+	}
+
+	cause = cause.Or(fmt.Sprintf("rollback to revision %d", id))
+	m.audit.Record(cause, audit.ActionRevisionRollback, fmt.Sprintf("%d", id), nil, diffStates(current, target.State))
+
+	// 同步到系统 hosts 文件
+	if m.syncer != nil {
+		if err := m.syncer.Sync(); err != nil {
+			log.Printf("Warning: failed to sync hosts to system: %v", err)
+		}
+	}
+
+	return m.captureLocked(cause)
+}
+
+// diffStates lists the items that differ between two states, ordered by source and key.
+func diffStates(from, to State) []Change {
+	sources := make(map[string]bool)
+	for name := range from {
+		sources[name] = true
+	}
+	for name := range to {
+		sources[name] = true
+	}
+
+	changes := make([]Change, 0)
+	for name := range sources {
+		before, after := from[name], to[name]
+		for key, b := range before {
+			a, ok := after[key]
+			switch {
+			case !ok:
+				changes = append(changes, Change{Source: name, Key: key, Kind: "removed", Before: b})
+			case !bytes.Equal(a, b):
+				changes = append(changes, Change{Source: name, Key: key, Kind: "changed", Before: b, After: a})
+			}
+		}
+		for key, a := range after {
+			if _, ok := before[key]; !ok {
+				changes = append(changes, Change{Source: name, Key: key, Kind: "added", After: a})
+			}
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Source != changes[j].Source {
+			return changes[i].Source < changes[j].Source
+		}
+		return changes[i].Key < changes[j].Key
+	})
+
+	return changes
+}
+
+func sameState(a, b State) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, itemsA := range a {
+		itemsB, ok := b[name]
+		if !ok || len(itemsA) != len(itemsB) {
+			return false
+		}
+		for key, v := range itemsA {
+			if !bytes.Equal(v, itemsB[key]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// RollbackRequest captures the payload of POST /revision/rollback.
+type RollbackRequest struct {
+	ID int64 `json:"id"`
+}
+
+// DiffQuery holds the parameters of GET /revision/diff.
+type DiffQuery struct {
+	From int64 `form:"from"`
+	To   int64 `form:"to"` // 0 means the latest revision
+}
+
+// ListResponse models the response of GET /revision/list.
+type ListResponse struct {
+	Code    int       `json:"code"`
+	Message string    `json:"message"`
+	Data    []Summary `json:"data"`
+}
+
+// DiffResponse models the response of GET /revision/diff.
+type DiffResponse struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    Diff   `json:"data"`
+}
+
+// RollbackResponse models the response of POST /revision/rollback. Data is
+// the revision recorded for the restored state.
+type RollbackResponse struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    int64  `json:"data"`
+}
@@ -0,0 +1,115 @@
+package revision
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// SQLiteStore keeps revisions in the revisions table.
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+var (
+	_ Store = (*FileStore)(nil)
+	_ Store = (*SQLiteStore)(nil)
+)
+
+// NewSQLiteStore creates the revisions table if needed.
+func NewSQLiteStore(db *sql.DB) (*SQLiteStore, error) {
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS revisions (
+		id     INTEGER PRIMARY KEY AUTOINCREMENT,
+		time   INTEGER NOT NULL,
+		actor  TEXT NOT NULL,
+		reason TEXT NOT NULL DEFAULT '',
+		state  TEXT NOT NULL
+	)`); err != nil {
+		return nil, fmt.Errorf("create revisions table: %w", err)
+	}
+
+	return &SQLiteStore{db: db}, nil
+}
+
+// Append inserts the revision.
+func (s *SQLiteStore) Append(r *Revision) error {
+	state, err := json.Marshal(r.State)
+	if err != nil {
+		return err
+	}
+
+	res, err := s.db.Exec(`INSERT INTO revisions (time, actor, reason, state) VALUES (?, ?, ?, ?)`,
+		r.Time.UnixNano(), r.Actor, r.Reason, string(state))
+	if err != nil {
+		return err
+	}
+
+	r.ID, err = res.LastInsertId()
+	return err
+}
+
+// Get returns the revision with the given ID.
+func (s *SQLiteStore) Get(id int64) (Revision, error) {
+	return s.scan(s.db.QueryRow(`SELECT id, time, actor, reason, state FROM revisions WHERE id = ?`, id))
+}
+
+// Latest returns the newest revision.
+func (s *SQLiteStore) Latest() (Revision, error) {
+	return s.scan(s.db.QueryRow(`SELECT id, time, actor, reason, state FROM revisions ORDER BY id DESC LIMIT 1`))
+}
+
+// List returns up to limit summaries, newest first.
+func (s *SQLiteStore) List(limit int) ([]Summary, error) {
+	rows, err := s.db.Query(`SELECT id, time, actor, reason, state FROM revisions ORDER BY id DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]Summary, 0)
+	for rows.Next() {
+		r, err := s.scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, r.Summary())
+	}
+
+	return result, rows.Err()
+}
+
+// Prune deletes all but the newest keep revisions.
+func (s *SQLiteStore) Prune(keep int) error {
+	_, err := s.db.Exec(`DELETE FROM revisions WHERE id NOT IN (SELECT id FROM revisions ORDER BY id DESC LIMIT ?)`, keep)
+	return err
+}
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func (s *SQLiteStore) scan(row rowScanner) (Revision, error) {
+	var (
+		r     Revision
+		nanos int64
+		state string
+	)
+
+	err := row.Scan(&r.ID, &nanos, &r.Actor, &r.Reason, &state)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Revision{}, ErrRevisionNotFound
+	}
+	if err != nil {
+		return Revision{}, err
+	}
+
+	r.Time = time.Unix(0, nanos)
+	if err := json.Unmarshal([]byte(state), &r.State); err != nil {
+		return Revision{}, fmt.Errorf("revision %d: invalid state: %w", r.ID, err)
+	}
+
+	return r, nil
+}
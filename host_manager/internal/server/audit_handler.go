@@ -0,0 +1,31 @@
+package server
+
+import (
+	"hostMgr/common/code"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"hostMgr/internal/audit"
+)
+
+// queryAudit 按 actor、action、target 和时间范围查询审计日志，最新的在前
+func (h *Handler) queryAudit(c *gin.Context) {
+	var query audit.Query
+	if err := c.ShouldBindQuery(&query); err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	records, err := h.audit.Query(query)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, audit.QueryResponse{
+		Code:    code.Success,
+		Message: "success",
+		Data:    records,
+	})
+}
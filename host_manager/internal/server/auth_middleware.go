@@ -0,0 +1,62 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"hostMgr/common/code"
+	"hostMgr/internal/auth"
+	"hostMgr/internal/host"
+)
+
+// maxBodySize bounds the body of authenticated requests, the largest being
+// bulk imports.
+const maxBodySize = 32 << 20
+
+// requireAuth rejects requests without valid credentials. The body is only
+// read for HMAC verification, up to maxBodySize, and restored for the handler.
+func (h *Handler) requireAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if h.authn == nil {
+			c.Next()
+			return
+		}
+
+		var body []byte
+		if c.Request.Body != nil {
+			c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBodySize)
+		}
+		if c.Request.Body != nil && c.Request.Header.Get(auth.SignatureHeader) != "" {
+			var err error
+			if body, err = io.ReadAll(c.Request.Body); err != nil {
+				status := http.StatusBadRequest
+				var tooLarge *http.MaxBytesError
+				if errors.As(err, &tooLarge) {
+					status = http.StatusRequestEntityTooLarge
+				}
+				c.AbortWithStatusJSON(status, host.MutationResponse{
+					Code:    status,
+					Message: err.Error(),
+				})
+				return
+			}
+			c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		}
+
+		if err := h.authn.Verify(c.Request, body); err != nil {
+			log.Printf("Rejected %s %s from %s: %v", c.Request.Method, c.Request.URL.Path, c.ClientIP(), err)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, host.MutationResponse{
+				Code:    code.Unauthorized,
+				Message: err.Error(),
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
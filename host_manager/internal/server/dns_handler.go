@@ -0,0 +1,41 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"hostMgr/internal/dns"
+)
+
+// SetDNS enables the DNS-over-HTTPS endpoint backed by handler. It must be
+// called before RegisterRoutes.
+func (h *Handler) SetDNS(handler *dns.Handler) {
+	h.dns = handler
+}
+
+// dnsQuery 实现 RFC 8484 DNS-over-HTTPS：托管域名返回当前优选 IP，其余查询转发到上游。
+// 遵循协议使用真实的 HTTP 状态码与 application/dns-message 响应体
+func (h *Handler) dnsQuery(c *gin.Context) {
+	query, err := dns.ReadDoHQuery(c.Request)
+	if err != nil {
+		status := http.StatusBadRequest
+		if err == dns.ErrUnsupportedContent {
+			status = http.StatusUnsupportedMediaType
+		}
+		c.String(status, err.Error())
+		return
+	}
+
+	resp := h.dns.HandleDoH(c.Request.Context(), query)
+	if resp == nil {
+		c.String(http.StatusBadRequest, "malformed dns query")
+		return
+	}
+
+	if ttl, ok := dns.MinTTL(resp); ok {
+		c.Header("Cache-Control", fmt.Sprintf("max-age=%d", ttl))
+	}
+	c.Data(http.StatusOK, dns.MessageContentType, resp)
+}
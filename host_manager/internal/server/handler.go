@@ -6,8 +6,13 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/patrickmn/go-cache"
 
+	"hostMgr/hostsync"
+	"hostMgr/internal/audit"
+	"hostMgr/internal/auth"
+	"hostMgr/internal/dns"
 	"hostMgr/internal/host"
 	"hostMgr/internal/opt"
+	"hostMgr/internal/revision"
 	"hostMgr/internal/tool"
 )
 
@@ -16,11 +21,16 @@ type Handler struct {
 	svc     *host.Service
 	optSvc  *opt.Service
 	toolSvc *tool.ToolService
+	audit   *audit.Logger
+	rev     *revision.Manager
+	authn   *auth.Authenticator  // 为 nil 时修改类接口不校验凭证
+	dns     *dns.Handler         // 为 nil 时不提供 /dns-query
+	recon   *hostsync.Reconciler // 为 nil 时不提供 /sync/status
 	cache   *cache.Cache
 }
 
 // NewHandler creates a Gin handler with the provided services.
-func NewHandler(svc *host.Service, optSvc *opt.Service, toolSvc *tool.ToolService) *Handler {
+func NewHandler(svc *host.Service, optSvc *opt.Service, toolSvc *tool.ToolService, auditLog *audit.Logger, revisions *revision.Manager, authn *auth.Authenticator) *Handler {
 	// 创建缓存实例：默认过期时间 5 分钟，清理周期 10 分钟
 	c := cache.New(5*time.Minute, 10*time.Minute)
 
@@ -28,25 +38,77 @@ func NewHandler(svc *host.Service, optSvc *opt.Service, toolSvc *tool.ToolServic
 		svc:     svc,
 		optSvc:  optSvc,
 		toolSvc: toolSvc,
+		audit:   auditLog,
+		rev:     revisions,
+		authn:   authn,
 		cache:   c,
 	}
 }
 
-// RegisterRoutes wires all endpoints into the given router.
+// RegisterRoutes wires all endpoints into the given router. Routes that
+// change state require credentials; read-only routes stay open.
 func (h *Handler) RegisterRoutes(r *gin.Engine) {
+	w := r.Group("", h.requireAuth())
+
 	// host 相关路由
 	r.GET("/host", h.getHost)
-	r.POST("/host", h.createHost)
-	r.DELETE("/host", h.deleteHost)
+	w.POST("/host", h.createHost)
+	w.PATCH("/host", h.updateHost)
+	w.PUT("/host", h.updateHost)
+	w.DELETE("/host", h.deleteHost)
 	r.GET("/host/list", h.listHosts)
+	w.POST("/host/pin", h.pinHost)
+	w.DELETE("/host/pin", h.unpinHost)
+	w.POST("/host/toggle", h.setHostEnabled)
+	r.GET("/host/export", h.exportHosts)
+	w.POST("/host/import", h.importHosts)
+	r.GET("/host/adoptable", h.listAdoptable)
+	w.POST("/host/adopt", h.adoptHosts)
 
 	// opt 相关路由
-	r.POST("/opt/report", h.reportOpt)
+	w.POST("/opt/report", h.reportOpt)
 	r.GET("/opt", h.getCurrentOpt)
-	r.GET("/opt/change", h.changeOpt)
+	w.GET("/opt/change", h.changeOpt)
+	r.GET("/opt/history", h.getOptHistory)
+	r.GET("/opt/quarantine", h.getOptQuarantine)
+	w.DELETE("/opt/quarantine", h.clearOptQuarantine)
+	r.GET("/opt/status", h.getOptStatus)
+	w.POST("/opt/reoptimize", h.reoptimize)
 
 	// tool 相关路由
 	r.GET("/tool/webDetails", h.getWebDetails)
+
+	// 系统 hosts 同步
+	r.GET("/sync/preview", h.previewSync)
+	if h.recon != nil {
+		r.GET("/sync/status", h.syncStatus)
+	}
+
+	// DNS-over-HTTPS，只读查询无需认证
+	if h.dns != nil {
+		r.GET("/dns-query", h.dnsQuery)
+		r.POST("/dns-query", h.dnsQuery)
+	}
+
+	// 审计日志
+	r.GET("/audit", h.queryAudit)
+
+	// 版本快照
+	r.GET("/revision/list", h.listRevisions)
+	r.GET("/revision/diff", h.diffRevisions)
+	w.POST("/revision/rollback", h.rollbackRevision)
+}
+
+// auditReasonHeader lets API clients explain a change in the audit log.
+const auditReasonHeader = "X-Audit-Reason"
+
+// apiCause describes a change requested through the HTTP API.
+func apiCause(c *gin.Context) audit.Cause {
+	return audit.Cause{
+		Actor:  audit.ActorAPI,
+		Client: c.ClientIP(),
+		Reason: c.GetHeader(auditReasonHeader),
+	}
 }
 
 // respondError 通用错误响应函数
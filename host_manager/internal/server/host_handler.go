@@ -1,6 +1,8 @@
 package server
 
 import (
+	"errors"
+	"fmt"
 	"hostMgr/common/code"
 	"net/http"
 
@@ -25,17 +27,24 @@ func (h *Handler) getHost(c *gin.Context) {
 	})
 }
 
-// listHosts 列出所有 host 配置
+// listHosts 按筛选、排序和分页条件列出 host 配置
 func (h *Handler) listHosts(c *gin.Context) {
-	hosts := h.svc.ListHosts()
+	var query host.ListHostsQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	result, err := h.svc.QueryHosts(query)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
 
 	c.JSON(http.StatusOK, host.QueryHostListResponse{
 		Code:    code.Success,
 		Message: "success",
-		Data: host.QueryHostListResult{
-			Total: len(hosts),
-			List:  hosts,
-		},
+		Data:    result,
 	})
 }
 
@@ -47,14 +56,37 @@ func (h *Handler) createHost(c *gin.Context) {
 		return
 	}
 
-	if err := h.svc.CreateHost(req); err != nil {
+	created, err := h.svc.CreateHost(req, apiCause(c))
+	if err != nil {
 		respondError(c, http.StatusBadRequest, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, host.MutationResponse{
+	c.JSON(http.StatusOK, host.CreateHostResponse{
+		Code:    code.Success,
+		Message: fmt.Sprintf("created with type %s", created.Type),
+		Data:    created,
+	})
+}
+
+// updateHost 部分更新指定的 host 配置
+func (h *Handler) updateHost(c *gin.Context) {
+	var req host.UpdateHostRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	updated, err := h.svc.UpdateHost(req, apiCause(c))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, host.QueryHostResponse{
 		Code:    code.Success,
-		Message: "created",
+		Message: "updated",
+		Data:    updated,
 	})
 }
 
@@ -66,7 +98,7 @@ func (h *Handler) deleteHost(c *gin.Context) {
 		return
 	}
 
-	if err := h.svc.DeleteHost(req.Domain); err != nil {
+	if err := h.svc.DeleteHost(req.Domain, apiCause(c)); err != nil {
 		respondError(c, http.StatusBadRequest, err)
 		return
 	}
@@ -76,3 +108,157 @@ func (h *Handler) deleteHost(c *gin.Context) {
 		Message: "deleted",
 	})
 }
+
+// pinHost 将 host 固定到手动指定的 IP，不再跟随优选轮换
+func (h *Handler) pinHost(c *gin.Context) {
+	var req host.PinHostRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	pinned, err := h.svc.PinHost(req.Domain, req.IP, apiCause(c))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, host.QueryHostResponse{
+		Code:    code.Success,
+		Message: "pinned",
+		Data:    pinned,
+	})
+}
+
+// unpinHost 取消固定，恢复使用当前优选 IP
+func (h *Handler) unpinHost(c *gin.Context) {
+	var req host.PinHostRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	unpinned, err := h.svc.UnpinHost(req.Domain, apiCause(c))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, host.QueryHostResponse{
+		Code:    code.Success,
+		Message: "unpinned",
+		Data:    unpinned,
+	})
+}
+
+// setHostEnabled 启用或停用 host，停用后保留记录但不写入系统 hosts 文件
+func (h *Handler) setHostEnabled(c *gin.Context) {
+	var req host.SetHostEnabledRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	if req.Enabled == nil {
+		respondError(c, http.StatusBadRequest, errors.New("enabled is required"))
+		return
+	}
+
+	updated, err := h.svc.SetHostEnabled(req.Domain, *req.Enabled, apiCause(c))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	message := "disabled"
+	if updated.Enabled {
+		message = "enabled"
+	}
+
+	c.JSON(http.StatusOK, host.QueryHostResponse{
+		Code:    code.Success,
+		Message: message,
+		Data:    updated,
+	})
+}
+
+// exportHosts 导出全部 host，支持 json、hosts、csv 格式
+func (h *Handler) exportHosts(c *gin.Context) {
+	var query host.TransferQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	export, err := h.svc.ExportHosts(query.Format)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", export.Filename))
+	c.Data(http.StatusOK, export.ContentType, export.Content)
+}
+
+// importHosts 批量导入 host，请求体为 json、hosts 或 csv 格式的原始内容
+func (h *Handler) importHosts(c *gin.Context) {
+	var query host.TransferQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	data, err := c.GetRawData()
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	result, err := h.svc.ImportHosts(data, query.Format, query.Mode, apiCause(c))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, host.ImportHostsResponse{
+		Code:    code.Success,
+		Message: fmt.Sprintf("imported %d, failed %d", result.Imported, result.Failed),
+		Data:    result,
+	})
+}
+
+// listAdoptable 列出系统 hosts 文件中位于已知 CDN 网段、但未被接管的条目
+func (h *Handler) listAdoptable(c *gin.Context) {
+	candidates, err := h.svc.ListAdoptable()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, host.AdoptableHostsResponse{
+		Code:    code.Success,
+		Message: "success",
+		Data:    candidates,
+	})
+}
+
+// adoptHosts 接管选定的系统 hosts 条目
+func (h *Handler) adoptHosts(c *gin.Context) {
+	var req host.AdoptHostsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	result, err := h.svc.AdoptHosts(req.Domains, apiCause(c))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, host.AdoptHostsResponse{
+		Code:    code.Success,
+		Message: fmt.Sprintf("adopted %d, failed %d", len(result.Adopted), len(result.Errors)),
+		Data:    result,
+	})
+}
@@ -1,11 +1,13 @@
 package server
 
 import (
+	"errors"
 	"hostMgr/common/code"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 
+	"hostMgr/internal/audit"
 	"hostMgr/internal/opt"
 )
 
@@ -20,7 +22,11 @@ func (h *Handler) reportOpt(c *gin.Context) {
 		return
 	}
 
-	if err := h.optSvc.ReportOpt(req); err != nil {
+	if err := h.optSvc.ReportOpt(req, audit.Cause{
+		Actor:  audit.ActorOptimizer,
+		Client: c.ClientIP(),
+		Reason: c.GetHeader(auditReasonHeader),
+	}); err != nil {
 		c.JSON(http.StatusBadRequest, opt.BaseResponse{
 			Code:    http.StatusBadRequest,
 			Message: err.Error(),
@@ -55,12 +61,17 @@ func (h *Handler) getCurrentOpt(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, opt.GetOptResponse{
+	resp := opt.GetOptResponse{
 		Code:    code.Success,
 		Message: "success",
 		Type:    optType,
 		Data:    optInfo,
-	})
+	}
+	if statuses, err := h.optSvc.GetStatus(optType); err == nil && len(statuses) == 1 {
+		resp.Status = &statuses[0]
+	}
+
+	c.JSON(http.StatusOK, resp)
 }
 
 // changeOpt 更换指定类型的当前优选
@@ -75,7 +86,7 @@ func (h *Handler) changeOpt(c *gin.Context) {
 		return
 	}
 
-	if err := h.optSvc.ChangeOpt(optType); err != nil {
+	if err := h.optSvc.ChangeOpt(optType, apiCause(c)); err != nil {
 		c.JSON(http.StatusNotFound, opt.BaseResponse{
 			Code:    code.NotFound,
 			Message: err.Error(),
@@ -88,3 +99,131 @@ func (h *Handler) changeOpt(c *gin.Context) {
 		Message: "success",
 	})
 }
+
+// getOptHistory 按类型和时间范围获取优选上报历史(按时间先后)
+func (h *Handler) getOptHistory(c *gin.Context) {
+	var query opt.HistoryQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, opt.BaseResponse{
+			Code:    http.StatusBadRequest,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	reports, err := h.optSvc.GetHistory(query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, opt.BaseResponse{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, opt.HistoryResponse{
+		Code:    code.Success,
+		Message: "success",
+		Data:    reports,
+	})
+}
+
+// getOptQuarantine 获取隔离中的 IP, type 为空时返回所有类型
+func (h *Handler) getOptQuarantine(c *gin.Context) {
+	entries, err := h.optSvc.GetQuarantine(c.Query("type"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, opt.BaseResponse{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, opt.QuarantineResponse{
+		Code:    code.Success,
+		Message: "success",
+		Data:    entries,
+	})
+}
+
+// clearOptQuarantine 解除隔离, 未指定 ip 时解除该类型的全部隔离
+func (h *Handler) clearOptQuarantine(c *gin.Context) {
+	optType := c.Query("type")
+	if optType == "" {
+		c.JSON(http.StatusBadRequest, opt.BaseResponse{
+			Code:    http.StatusBadRequest,
+			Message: "type parameter is required",
+		})
+		return
+	}
+
+	cleared, err := h.optSvc.ClearQuarantine(optType, c.Query("ip"), apiCause(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, opt.BaseResponse{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, opt.ClearQuarantineResponse{
+		Code:    code.Success,
+		Message: "success",
+		Data:    cleared,
+	})
+}
+
+// getOptStatus 获取优选数据的新鲜度与存量, type 为空时返回所有类型
+func (h *Handler) getOptStatus(c *gin.Context) {
+	statuses, err := h.optSvc.GetStatus(c.Query("type"))
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, opt.ErrNoOptDataFound) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, opt.BaseResponse{
+			Code:    status,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, opt.StatusResponse{
+		Code:    code.Success,
+		Message: "success",
+		Data:    statuses,
+	})
+}
+
+// reoptimize 手动请求重新优选(忽略冷却时间)
+func (h *Handler) reoptimize(c *gin.Context) {
+	optType := c.Query("type")
+	if optType == "" {
+		c.JSON(http.StatusBadRequest, opt.BaseResponse{
+			Code:    http.StatusBadRequest,
+			Message: "type parameter is required",
+		})
+		return
+	}
+
+	reason := c.GetHeader(auditReasonHeader)
+	if reason == "" {
+		reason = "requested via api"
+	}
+
+	if err := h.optSvc.Reoptimize(optType, reason, true); err != nil {
+		status := http.StatusConflict
+		if errors.Is(err, opt.ErrReoptimizeDisabled) {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, opt.BaseResponse{
+			Code:    status,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, opt.BaseResponse{
+		Code:    code.Success,
+		Message: "re-optimization started",
+	})
+}
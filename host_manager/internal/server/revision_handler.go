@@ -0,0 +1,88 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"hostMgr/common/code"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"hostMgr/internal/revision"
+)
+
+// listRevisions 列出最近的版本快照，最新的在前
+func (h *Handler) listRevisions(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "0"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, fmt.Errorf("invalid limit: %w", err))
+		return
+	}
+
+	summaries, err := h.rev.List(limit)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, revision.ListResponse{
+		Code:    code.Success,
+		Message: "success",
+		Data:    summaries,
+	})
+}
+
+// diffRevisions 对比两个版本之间变化的 host 与优选数据
+func (h *Handler) diffRevisions(c *gin.Context) {
+	var query revision.DiffQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+	if query.From <= 0 {
+		respondError(c, http.StatusBadRequest, errors.New("from is required"))
+		return
+	}
+
+	diff, err := h.rev.Diff(query.From, query.To)
+	if err != nil {
+		respondError(c, http.StatusNotFound, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, revision.DiffResponse{
+		Code:    code.Success,
+		Message: "success",
+		Data:    diff,
+	})
+}
+
+// rollbackRevision 回滚到指定版本并重新同步系统 hosts 文件
+func (h *Handler) rollbackRevision(c *gin.Context) {
+	var req revision.RollbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+	if req.ID <= 0 {
+		respondError(c, http.StatusBadRequest, errors.New("id is required"))
+		return
+	}
+
+	id, err := h.rev.Rollback(req.ID, apiCause(c))
+	if err != nil {
+		if errors.Is(err, revision.ErrRevisionNotFound) {
+			respondError(c, http.StatusNotFound, err)
+			return
+		}
+		respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, revision.RollbackResponse{
+		Code:    code.Success,
+		Message: fmt.Sprintf("rolled back to revision %d", req.ID),
+		Data:    id,
+	})
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"hostMgr/common/code"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"hostMgr/hostsync"
+	"hostMgr/internal/host"
+)
+
+// SetReconciler enables GET /sync/status backed by r. It must be called
+// before RegisterRoutes.
+func (h *Handler) SetReconciler(r *hostsync.Reconciler) {
+	h.recon = r
+}
+
+// previewSync 预览同步将对系统 hosts 文件做出的修改，不写入任何内容；
+// format=diff 时直接返回 unified diff 文本
+func (h *Handler) previewSync(c *gin.Context) {
+	plan, err := h.svc.PreviewSync()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	if c.Query("format") == "diff" {
+		c.String(http.StatusOK, plan.Diff)
+		return
+	}
+
+	message := "no changes"
+	if plan.Changed {
+		message = "changes pending"
+	}
+	c.JSON(http.StatusOK, host.SyncPreviewResponse{
+		Code:    code.Success,
+		Message: message,
+		Data:    plan,
+	})
+}
+
+// syncStatus 返回管理区域当前是否与数据一致，以及最近检测到的被改写记录
+func (h *Handler) syncStatus(c *gin.Context) {
+	status := h.recon.Status()
+
+	message := "in sync"
+	if !status.InSync {
+		message = "drifted"
+		if status.Error != "" {
+			message = "check failed"
+		}
+	}
+	c.JSON(http.StatusOK, host.SyncStatusResponse{
+		Code:    code.Success,
+		Message: message,
+		Data:    status,
+	})
+}
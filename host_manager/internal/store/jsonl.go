@@ -0,0 +1,147 @@
+package store
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// JSONLFile is an append-only file of JSON lines, used by the file-backed
+// audit log and opt history. A record torn by a crash or a full disk never
+// corrupts the records after it: a partial last line is terminated when the
+// file is opened or after a failed append, and lines that do not decode are
+// skipped when scanning. JSONLFile is not safe for concurrent use; callers
+// serialize access with their own lock.
+type JSONLFile struct {
+	path string
+	torn bool // the last append failed and may have left a partial line
+}
+
+// OpenJSONL opens the JSON lines file at path, creating its directory if
+// needed. The file itself is created by the first Append.
+func OpenJSONL(path string) (*JSONLFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+
+	f := &JSONLFile{path: path}
+	if err := f.terminateLastLine(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// terminateLastLine ends a partial last line left by an interrupted append,
+// so the next record starts on its own line instead of extending it.
+func (f *JSONLFile) terminateLastLine() error {
+	file, err := os.OpenFile(f.path, os.O_RDWR, 0o644)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil || info.Size() == 0 {
+		return err
+	}
+
+	last := make([]byte, 1)
+	if _, err := file.ReadAt(last, info.Size()-1); err != nil {
+		return err
+	}
+	if last[0] == '\n' {
+		return nil
+	}
+	_, err = file.WriteAt([]byte{'\n'}, info.Size())
+	return err
+}
+
+// Append writes v as a new line.
+func (f *JSONLFile) Append(v interface{}) error {
+	line, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+
+	if f.torn {
+		line = append([]byte{'\n'}, line...)
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		f.torn = true
+		return err
+	}
+	f.torn = false
+	return file.Close()
+}
+
+// Scan calls decode for every non-empty line in file order. Lines decode
+// rejects are skipped and counted. A missing file has no lines.
+func (f *JSONLFile) Scan(decode func(line []byte) error) (int, error) {
+	file, err := os.Open(f.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	skipped := 0
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		if err := decode(scanner.Bytes()); err != nil {
+			skipped++
+		}
+	}
+
+	return skipped, scanner.Err()
+}
+
+// Rewrite replaces the file with n lines, the i-th holding record(i). The new
+// content is written to a temporary file first, so a failed rewrite leaves
+// the old file intact.
+func (f *JSONLFile) Rewrite(n int, record func(i int) interface{}) error {
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), "."+filepath.Base(f.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	for i := 0; i < n; i++ {
+		line, err := json.Marshal(record(i))
+		if err != nil {
+			tmp.Close()
+			return err
+		}
+		w.Write(line)
+		w.WriteByte('\n')
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), f.path); err != nil {
+		return err
+	}
+	f.torn = false
+	return nil
+}
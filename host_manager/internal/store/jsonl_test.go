@@ -0,0 +1,78 @@
+package store
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type jsonlRecord struct {
+	ID int `json:"id"`
+}
+
+func scanIDs(t *testing.T, f *JSONLFile) ([]int, int) {
+	t.Helper()
+
+	var ids []int
+	skipped, err := f.Scan(func(line []byte) error {
+		var r jsonlRecord
+		if err := json.Unmarshal(line, &r); err != nil {
+			return err
+		}
+		ids = append(ids, r.ID)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("scan: %v", err)
+	}
+	return ids, skipped
+}
+
+func TestJSONLFileRecoversTornLastLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data", "records.jsonl")
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	// 模拟追加到一半时崩溃留下的不完整行
+	if err := os.WriteFile(path, []byte("{\"id\":1}\n{\"id\":"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	f, err := OpenJSONL(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if err := f.Append(jsonlRecord{ID: 2}); err != nil {
+		t.Fatalf("append: %v", err)
+	}
+
+	ids, skipped := scanIDs(t, f)
+	if len(ids) != 2 || ids[0] != 1 || ids[1] != 2 {
+		t.Fatalf("ids = %v, want [1 2]", ids)
+	}
+	if skipped != 1 {
+		t.Fatalf("skipped = %d, want 1", skipped)
+	}
+}
+
+func TestJSONLFileRewrite(t *testing.T) {
+	f, err := OpenJSONL(filepath.Join(t.TempDir(), "records.jsonl"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	for i := 1; i <= 3; i++ {
+		if err := f.Append(jsonlRecord{ID: i}); err != nil {
+			t.Fatalf("append: %v", err)
+		}
+	}
+
+	kept := []jsonlRecord{{ID: 3}}
+	if err := f.Rewrite(len(kept), func(i int) interface{} { return kept[i] }); err != nil {
+		t.Fatalf("rewrite: %v", err)
+	}
+
+	if ids, _ := scanIDs(t, f); len(ids) != 1 || ids[0] != 3 {
+		t.Fatalf("ids = %v, want [3]", ids)
+	}
+}
@@ -1,19 +1,29 @@
 package main
 
 import (
+	"database/sql"
 	"flag"
 	"fmt"
 	"hostMgr/config"
+	"hostMgr/hostsync"
 	"hostMgr/internal/extSvc"
 	"log"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 
+	"hostMgr/internal/audit"
+	"hostMgr/internal/auth"
+	"hostMgr/internal/cdn"
+	"hostMgr/internal/dns"
 	"hostMgr/internal/host"
 	"hostMgr/internal/opt"
+	"hostMgr/internal/revision"
 	"hostMgr/internal/server"
+	"hostMgr/internal/store"
 	"hostMgr/internal/tool"
 )
 
@@ -28,6 +38,9 @@ var (
 	helpShort    = flag.Bool("h", false, "show help message (shorthand)")
 	versionFlag  = flag.Bool("version", false, "show version information")
 	versionShort = flag.Bool("v", false, "show version information (shorthand)")
+	listAdopt    = flag.Bool("list-adoptable", false, "list unmanaged system hosts entries in known CDN ranges and exit")
+	adoptFlag    = flag.String("adopt", "", "comma-separated domains to adopt from the system hosts file, then exit")
+	syncPreview  = flag.Bool("sync-preview", false, "print the diff a sync would apply to the system hosts file and exit")
 )
 
 func main() {
@@ -57,37 +70,172 @@ func main() {
 		log.Fatalf("load config: %v", err)
 	}
 
-	// 初始化 host repository
-	repo, err := host.NewFileRepository(cfg.Data.HostFile)
+	// 初始化 host / opt repository 与审计日志
+	st, err := openStorage(cfg)
 	if err != nil {
 		log.Fatalf("init repository: %v", err)
 	}
+	defer st.close()
+	auditLog := audit.NewLogger(st.audit)
+
+	// host service 与 opt service 共用同一个 syncer，备份目录位于 host_file 所在目录
+	syncer := hostsync.NewSyncer(cfg.Data.HostFile)
+	targets, err := openSyncTargets(cfg)
+	if err != nil {
+		log.Fatalf("init sync targets: %v", err)
+	}
+	syncer.SetTargets(targets...)
+	syncer.SetSystemHostsEnabled(cfg.Sync.SystemHosts)
+	if !cfg.Sync.SystemHosts {
+		log.Printf("System hosts file sync is disabled, only sync targets are written")
+	}
+
+	// 初始化 CDN 类型识别
+	detector, err := cdn.NewDetector(cfg.CDN.Ranges)
+	if err != nil {
+		log.Fatalf("init cdn detector: %v", err)
+	}
 
 	// 初始化 host service
-	hostSvc := host.NewService(repo)
+	hostSvc := host.NewService(st.hosts, syncer, detector, cfg.CDN.DefaultType)
+	hostSvc.SetFallbackCount(cfg.Failover.Fallbacks)
+	hostSvc.SetAuditLogger(auditLog)
 	extSvc.HostService = hostSvc
 
-	// 初始化 opt repository
-	optRepo, err := opt.NewRepository(cfg.Data.OptFile)
+	// 只读的一次性命令在生成 token、记录启动快照等任何写入之前处理
+	if *listAdopt {
+		runListAdoptable(hostSvc)
+		return
+	}
+	if *syncPreview {
+		runSyncPreview(hostSvc)
+		return
+	}
+
+	authn, token, err := openAuthenticator(cfg)
 	if err != nil {
-		log.Fatalf("init opt repository: %v", err)
+		log.Fatalf("init auth: %v", err)
 	}
 
 	// 初始化 opt service
-	optSvc := opt.NewService(optRepo, cfg.Data.HostFile)
+	optSvc := opt.NewService(st.opts, syncer)
+	optSvc.SetAuditLogger(auditLog)
+	optSvc.SetHistory(st.history, cfg.History.GetRetention())
+	optSvc.SetQuarantineCooldown(cfg.Opt.GetQuarantineCooldown())
+	optSvc.SetFreshness(cfg.Opt.GetMaxAge(), cfg.Opt.MinPool)
+	reoptimizer := opt.NewReoptimizer(cfg.Opt.Reoptimize.URL, cfg.Opt.Reoptimize.Command, cfg.Opt.Reoptimize.GetCooldown(), cfg.Opt.Reoptimize.GetTimeout())
+	if authn != nil {
+		reoptimizer.SetCredentials(token, cfg.Auth.HMACSecret)
+	}
+	optSvc.SetReoptimizer(reoptimizer)
+	optSvc.SetMergeOptions(opt.MergeOptions{
+		DefaultMode: cfg.Opt.ReportMode,
+		Weights:     opt.ScoreWeights(cfg.Opt.Merge.Weights),
+		EntryMaxAge: cfg.Opt.Merge.GetEntryMaxAge(),
+		MaxPool:     cfg.Opt.Merge.MaxPool,
+	})
+
+	// 初始化版本快照，启动时记录当前状态作为可回滚的基线
+	revisions := revision.NewManager(st.revisions, syncer, cfg.Revision.Keep)
+	revisions.SetAuditLogger(auditLog)
+	hostSvc.SetRevisions(revisions)
+	optSvc.SetRevisions(revisions)
+	revisions.Capture(audit.Cause{Actor: audit.ActorSystem, Reason: "startup"})
 	extSvc.OptService = optSvc
 
+	// 处理一次性命令：接管系统 hosts 中已有的 CDN 条目
+	if *adoptFlag != "" {
+		runAdopt(hostSvc, *adoptFlag)
+		return
+	}
+
+	// 启动时写入一次同步目标，新配置的目标无需等到下一次修改
+	if len(targets) > 0 {
+		if err := syncer.SyncTargets(); err != nil {
+			log.Printf("Warning: failed to sync targets: %v", err)
+		}
+	}
+
+	// 定期检查管理区域是否被其他工具改写，改写记录写入审计日志
+	reconciler := hostsync.NewReconciler(syncer, cfg.Sync.Reconcile.GetInterval(), cfg.Sync.Reconcile.Repair)
+	reconciler.SetDriftHandler(func(e hostsync.DriftEvent) {
+		reason := "managed section drifted: " + e.Drift.String()
+		if e.Repaired {
+			reason += " (repaired)"
+		}
+		auditLog.Record(audit.Cause{Actor: audit.ActorScheduler, Reason: reason}, audit.ActionSyncDrift, syncer.GetSystemHostsPath(), nil, e)
+	})
+	if cfg.Sync.Reconcile.Enabled && cfg.Sync.SystemHosts {
+		reconciler.Start()
+		defer reconciler.Stop()
+		log.Printf("Hosts reconciler started (interval %s, repair %v)", cfg.Sync.Reconcile.GetInterval(), cfg.Sync.Reconcile.Repair)
+	}
+
+	// 启动备用 IP 故障转移检测
+	if cfg.Failover.Enabled {
+		checker := host.NewFailoverChecker(hostSvc, cfg.Failover.GetInterval(), cfg.Failover.GetTimeout())
+		checker.Start()
+		defer checker.Stop()
+		log.Printf("Failover checker started (interval %s)", cfg.Failover.GetInterval())
+	}
+
+	// 启动当前优选 IP 健康检测, 连续失败时自动更换
+	if cfg.Health.Enabled {
+		health := host.NewHealthMonitor(hostSvc, optSvc, host.HealthOptions{
+			Interval:   cfg.Health.GetInterval(),
+			Timeout:    cfg.Health.GetTimeout(),
+			MaxLatency: cfg.Health.GetMaxLatency(),
+			Failures:   cfg.Health.Failures,
+			HTTPPath:   cfg.Health.HTTPPath,
+		})
+		health.Start()
+		defer health.Stop()
+		log.Printf("Opt health monitor started (interval %s)", cfg.Health.GetInterval())
+	}
+
+	// 启动内置 DNS 服务，与 DoH 接口共用同一个 handler
+	dnsHandler := dns.NewHandler(hostSvc, dns.NewUpstreamForwarder(cfg.DNS.Upstreams, cfg.DNS.GetTimeout()), cfg.DNS.TTL)
+	if cfg.DNS.Enabled {
+		dnsServer := dns.NewServer(cfg.DNS.Listen, dnsHandler)
+		if err := dnsServer.Start(); err != nil {
+			log.Fatalf("start dns server: %v", err)
+		}
+		defer dnsServer.Stop()
+		log.Printf("DNS server listening on %s (udp/tcp), upstreams %s", cfg.DNS.Listen, strings.Join(cfg.DNS.Upstreams, ", "))
+	}
+
+	// 启动限时 host 过期清理
+	reaper := host.NewExpiryReaper(hostSvc, cfg.Expiry.GetCheckInterval())
+	reaper.Start()
+	defer reaper.Stop()
+
+	// 启动优选数据过期与存量检查
+	monitor := opt.NewFreshnessMonitor(optSvc, cfg.Opt.GetCheckInterval())
+	monitor.Start()
+	defer monitor.Stop()
+
 	// 初始化 tool service
 	toolSvc := tool.NewToolService()
 
-	handler := server.NewHandler(hostSvc, optSvc, toolSvc)
+	handler := server.NewHandler(hostSvc, optSvc, toolSvc, auditLog, revisions, authn)
+	if cfg.Sync.SystemHosts {
+		handler.SetReconciler(reconciler)
+	}
+	if cfg.DNS.DoH {
+		handler.SetDNS(dnsHandler)
+		log.Printf("DNS-over-HTTPS endpoint enabled at /dns-query")
+	}
 
 	router := gin.New()
 	router.Use(gin.Logger(), gin.Recovery(), buildCorsMiddleware(cfg))
 	handler.RegisterRoutes(router)
 
-	log.Printf("Host service listening on %s using data file %s", cfg.Server.Port, cfg.Data.HostFile)
-	log.Printf("Opt service using data file %s", cfg.Data.OptFile)
+	if cfg.Data.Driver == config.DriverSQLite {
+		log.Printf("Host service listening on %s using database %s", cfg.Server.Port, cfg.Data.SQLiteFile)
+	} else {
+		log.Printf("Host service listening on %s using data file %s", cfg.Server.Port, cfg.Data.HostFile)
+		log.Printf("Opt service using data file %s", cfg.Data.OptFile)
+	}
 	log.Printf("Tool service initialized with DNS resolver and IP geolocation service")
 	log.Printf("Config file: %s", configPath)
 	if err := router.Run(cfg.Server.Port); err != nil {
@@ -105,12 +253,252 @@ func printHelp() {
 	fmt.Println("  -c, --config <file>    Path to the configuration file (default: data/config.yaml)")
 	fmt.Println("  -h, --help             Show this help message")
 	fmt.Println("  -v, --version          Show version information")
+	fmt.Println("  --list-adoptable       List unmanaged system hosts entries in known CDN ranges and exit")
+	fmt.Println("  --adopt <domains>      Adopt comma-separated unmanaged domains into the managed section and exit")
+	fmt.Println("  --sync-preview         Print the diff a sync would apply to the system hosts file and exit")
 	fmt.Println()
 	fmt.Println("Examples:")
 	fmt.Println("  host_manager")
 	fmt.Println("  host_manager -c /path/to/config.yaml")
 	fmt.Println("  host_manager --config /path/to/config.yaml")
 	fmt.Println("  host_manager --version")
+	fmt.Println("  sudo host_manager --adopt github.com,api.github.com")
+	fmt.Println("  host_manager --sync-preview")
+}
+
+// storage bundles the repositories of the configured data driver.
+type storage struct {
+	hosts     host.Repository
+	opts      opt.Repository
+	audit     audit.Store
+	revisions revision.Store
+	history   opt.HistoryStore
+	close     func()
+}
+
+// openStorage opens the host, opt and audit storage selected by cfg.Data.Driver.
+// The first time the SQLite backend is used, hosts.json and opts.json are
+// migrated into the database.
+func openStorage(cfg *config.Config) (*storage, error) {
+	switch cfg.Data.Driver {
+	case "", config.DriverJSON:
+		hostRepo, err := host.NewFileRepository(cfg.Data.HostFile)
+		if err != nil {
+			return nil, err
+		}
+		optRepo, err := opt.NewFileRepository(cfg.Data.OptFile)
+		if err != nil {
+			return nil, err
+		}
+		auditStore, err := audit.NewFileStore(cfg.Data.AuditFile)
+		if err != nil {
+			return nil, err
+		}
+		revisionStore, err := revision.NewFileStore(cfg.Data.RevisionDir)
+		if err != nil {
+			return nil, err
+		}
+		historyStore, err := opt.NewFileHistoryStore(cfg.Data.HistoryFile)
+		if err != nil {
+			return nil, err
+		}
+		return &storage{
+			hosts:     hostRepo,
+			opts:      optRepo,
+			audit:     auditStore,
+			revisions: revisionStore,
+			history:   historyStore,
+			close:     func() {},
+		}, nil
+
+	case config.DriverSQLite:
+		db, err := store.OpenSQLite(cfg.Data.SQLiteFile)
+		if err != nil {
+			return nil, err
+		}
+
+		st, err := openSQLiteStorage(cfg, db)
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+		return st, nil
+
+	default:
+		return nil, fmt.Errorf("unknown data driver %q", cfg.Data.Driver)
+	}
+}
+
+func openSQLiteStorage(cfg *config.Config, db *sql.DB) (*storage, error) {
+	hostRepo, err := host.NewSQLiteRepository(db)
+	if err != nil {
+		return nil, err
+	}
+	optRepo, err := opt.NewSQLiteRepository(db)
+	if err != nil {
+		return nil, err
+	}
+	auditStore, err := audit.NewSQLiteStore(db)
+	if err != nil {
+		return nil, err
+	}
+	revisionStore, err := revision.NewSQLiteStore(db)
+	if err != nil {
+		return nil, err
+	}
+	historyStore, err := opt.NewSQLiteHistoryStore(db)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := migrateJSONStore(cfg, db, hostRepo, optRepo); err != nil {
+		return nil, err
+	}
+
+	return &storage{
+		hosts:     hostRepo,
+		opts:      optRepo,
+		audit:     auditStore,
+		revisions: revisionStore,
+		history:   historyStore,
+		close:     func() { db.Close() },
+	}, nil
+}
+
+// jsonMigratedKey marks a database that has already imported the JSON files.
+const jsonMigratedKey = "json_migrated"
+
+// migrateJSONStore imports hosts.json and opts.json into a fresh database once.
+// The JSON files are left in place so switching back to the json driver still works.
+func migrateJSONStore(cfg *config.Config, db *sql.DB, hostRepo *host.SQLiteRepository, optRepo *opt.SQLiteRepository) error {
+	done, err := store.GetMeta(db, jsonMigratedKey)
+	if err != nil {
+		return err
+	}
+	if done != "" {
+		return nil
+	}
+
+	hosts, err := hostRepo.ImportJSON(cfg.Data.HostFile)
+	if err != nil {
+		return fmt.Errorf("migrate %s: %w", cfg.Data.HostFile, err)
+	}
+	opts, err := optRepo.ImportJSON(cfg.Data.OptFile)
+	if err != nil {
+		return fmt.Errorf("migrate %s: %w", cfg.Data.OptFile, err)
+	}
+
+	if err := store.SetMeta(db, jsonMigratedKey, time.Now().Format(time.RFC3339)); err != nil {
+		return err
+	}
+
+	log.Printf("Migrated %d host(s) and %d opt type(s) from JSON into %s", hosts, opts, cfg.Data.SQLiteFile)
+	return nil
+}
+
+// openAuthenticator builds the authenticator for mutating routes. Without a
+// configured token or HMAC secret a random token is generated once and kept in
+// cfg.Auth.TokenFile, so the API is never left open by accident. The token in
+// use is returned so local optimizer commands can report with it.
+func openAuthenticator(cfg *config.Config) (*auth.Authenticator, string, error) {
+	if !cfg.Auth.Enabled {
+		log.Printf("Warning: authentication is disabled, any client (including web pages) can modify hosts")
+		return nil, "", nil
+	}
+
+	token := cfg.Auth.Token
+	if token == "" && cfg.Auth.HMACSecret == "" {
+		var created bool
+		var err error
+		token, created, err = auth.LoadOrCreateToken(cfg.Auth.TokenFile)
+		if err != nil {
+			return nil, "", err
+		}
+		if created {
+			log.Printf("Generated API token in %s; send it as \"Authorization: Bearer <token>\" to modify hosts", cfg.Auth.TokenFile)
+		} else {
+			log.Printf("Using API token from %s", cfg.Auth.TokenFile)
+		}
+	}
+
+	return auth.New(token, cfg.Auth.HMACSecret), token, nil
+}
+
+// openSyncTargets builds the enabled resolver targets written alongside the
+// system hosts file.
+func openSyncTargets(cfg *config.Config) ([]hostsync.Target, error) {
+	configs := []struct {
+		format string
+		cfg    config.SyncTargetConfig
+	}{
+		{hostsync.TargetDnsmasq, cfg.Sync.Targets.Dnsmasq},
+		{hostsync.TargetUnbound, cfg.Sync.Targets.Unbound},
+		{hostsync.TargetCoreDNS, cfg.Sync.Targets.CoreDNS},
+		{hostsync.TargetAdGuard, cfg.Sync.Targets.AdGuard},
+	}
+
+	var targets []hostsync.Target
+	for _, c := range configs {
+		if !c.cfg.Enabled {
+			continue
+		}
+		target, err := hostsync.NewFileTarget(c.format, c.cfg.Path, c.cfg.Reload)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, target)
+		log.Printf("Sync target enabled: %s", target.Name())
+	}
+	return targets, nil
+}
+
+func runListAdoptable(hostSvc *host.Service) {
+	candidates, err := hostSvc.ListAdoptable()
+	if err != nil {
+		log.Fatalf("list adoptable hosts: %v", err)
+	}
+
+	if len(candidates) == 0 {
+		fmt.Println("No unmanaged entries in known CDN ranges found.")
+		return
+	}
+
+	for _, c := range candidates {
+		fmt.Printf("%-40s %-12s %s (lines %v)\n", c.Domain, c.Type, strings.Join(c.IPs, ","), c.Lines)
+	}
+}
+
+func runAdopt(hostSvc *host.Service, domains string) {
+	result, err := hostSvc.AdoptHosts(strings.Split(domains, ","), audit.Cause{Actor: audit.ActorCLI})
+	if err != nil {
+		log.Fatalf("adopt hosts: %v", err)
+	}
+
+	for _, h := range result.Adopted {
+		fmt.Printf("adopted  %-40s %-12s %s\n", h.Domain, h.Type, strings.Join(h.IPs, ","))
+	}
+	for _, e := range result.Errors {
+		fmt.Printf("failed   %-40s %s\n", e.Domain, e.Reason)
+	}
+
+	if len(result.Errors) > 0 {
+		os.Exit(1)
+	}
+}
+
+func runSyncPreview(hostSvc *host.Service) {
+	plan, err := hostSvc.PreviewSync()
+	if err != nil {
+		log.Fatalf("preview sync: %v", err)
+	}
+
+	if !plan.Changed {
+		fmt.Printf("%s is up to date.\n", plan.Path)
+		return
+	}
+
+	fmt.Print(plan.Diff)
+	fmt.Printf("%d line(s) added, %d removed\n", plan.Added, plan.Removed)
 }
 
 func buildCorsMiddleware(cfg *config.Config) gin.HandlerFunc {